@@ -0,0 +1,107 @@
+package lgtm
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+// BackgroundStyle はテキストの背景の形
+type BackgroundStyle string
+
+const (
+	BackgroundBox   BackgroundStyle = "box"   // テキストを囲む角丸の矩形
+	BackgroundBand  BackgroundStyle = "band"  // 画像の幅いっぱいの帯
+	BackgroundScrim BackgroundStyle = "scrim" // 上下の端に向かって透明になる画像の幅いっぱいの帯
+)
+
+// BackgroundStyles は指定できる背景の形
+var BackgroundStyles = []BackgroundStyle{BackgroundBox, BackgroundBand, BackgroundScrim}
+
+// Background は写真の上でもテキストを読みやすくするための半透明の背景
+// 位置と大きさはレイアウトで計算したテキストのバウンディングボックスから決める
+// 0の項目はデフォルト値を使う
+type Background struct {
+	Style   BackgroundStyle
+	Color   color.Color // 背景の色（デフォルトは黒）
+	Opacity float64     // 不透明度 0〜1（デフォルトは0.5）
+	Padding float64     // バウンディングボックスの外側の余白（ピクセル、デフォルトはフォントサイズの20%）
+	Radius  float64     // boxの角の半径（ピクセル、デフォルトは角丸なし）
+}
+
+// validate は背景の形と値の範囲を検査する
+func (b *Background) validate() error {
+	switch b.Style {
+	case BackgroundBox, BackgroundBand, BackgroundScrim:
+	default:
+		return fmt.Errorf("invalid background style %q: must be one of box, band, scrim", b.Style)
+	}
+	if b.Opacity < 0 || b.Opacity > 1 {
+		return fmt.Errorf("invalid background opacity %v: must be between 0 and 1", b.Opacity)
+	}
+	if b.Padding < 0 {
+		return fmt.Errorf("invalid background padding %v: must not be negative", b.Padding)
+	}
+	if b.Radius < 0 {
+		return fmt.Errorf("invalid background radius %v: must not be negative", b.Radius)
+	}
+	return nil
+}
+
+// color は不透明度を適用した背景の色を返す
+func (b *Background) color() color.Color {
+	c := b.Color
+	if c == nil {
+		c = color.Black
+	}
+	opacity := b.Opacity
+	if opacity == 0 {
+		opacity = 0.5
+	}
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	n.A = uint8(float64(n.A)*opacity + 0.5)
+	return n
+}
+
+// draw はテキストのバウンディングボックスの後ろに背景を描画する
+func (b *Background) draw(dc *gg.Context, box *TextBox) {
+	padding := b.Padding
+	if padding == 0 {
+		padding = box.FontSize * 0.2
+	}
+	bounds := box.Bounds
+	x, y := float64(bounds.Min.X)-padding, float64(bounds.Min.Y)-padding
+	w, h := float64(bounds.Dx())+padding*2, float64(bounds.Dy())+padding*2
+	width := float64(dc.Width())
+	c := b.color()
+
+	switch b.Style {
+	case BackgroundBox:
+		dc.SetColor(c)
+		if b.Radius > 0 {
+			dc.DrawRoundedRectangle(x, y, w, h, b.Radius)
+		} else {
+			dc.DrawRectangle(x, y, w, h)
+		}
+		dc.Fill()
+
+	case BackgroundBand:
+		dc.SetColor(c)
+		dc.DrawRectangle(0, y, width, h)
+		dc.Fill()
+
+	case BackgroundScrim:
+		// テキストの範囲は不透明度どおりに塗り、余白の分だけ上下に透明へ変化させる
+		top, bottom := y-padding, y+h+padding
+		gradient := gg.NewLinearGradient(0, top, 0, bottom)
+		transparent := color.NRGBA{}
+		gradient.AddColorStop(0, transparent)
+		gradient.AddColorStop((y-top)/(bottom-top), c)
+		gradient.AddColorStop((y+h-top)/(bottom-top), c)
+		gradient.AddColorStop(1, transparent)
+		dc.SetFillStyle(gradient)
+		dc.DrawRectangle(0, top, width, bottom-top)
+		dc.Fill()
+	}
+}
@@ -0,0 +1,83 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackground_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		bg      *Background
+		wantErr string
+	}{
+		{name: "box", bg: &Background{Style: BackgroundBox, Opacity: 0.7, Padding: 4, Radius: 6}},
+		{name: "band", bg: &Background{Style: BackgroundBand}},
+		{name: "scrim", bg: &Background{Style: BackgroundScrim, Opacity: 1}},
+		{name: "unknown style", bg: &Background{Style: "circle"}, wantErr: `invalid background style "circle"`},
+		{name: "opacity out of range", bg: &Background{Style: BackgroundBox, Opacity: 1.5}, wantErr: "invalid background opacity 1.5"},
+		{name: "negative padding", bg: &Background{Style: BackgroundBox, Padding: -1}, wantErr: "invalid background padding -1"},
+		{name: "negative radius", bg: &Background{Style: BackgroundBox, Radius: -1}, wantErr: "invalid background radius -1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.bg.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	d := &TextDrawer{MainText: NewMainText(DefaultMainText, TextColorWhite)}
+	d.MainText.Background = &Background{Style: "circle"}
+	_, err := d.layout(context.Background(), image.Rect(0, 0, 100, 100))
+	assert.Error(t, err)
+}
+
+func TestBackground_Draw(t *testing.T) {
+	canvas := image.Rect(0, 0, 400, 300)
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	r, err := Layout(canvas, main, nil, LayoutOptions{})
+	require.NoError(t, err)
+	box := r.Main
+
+	// 白い画像に不透明度0.5の黒い背景を描く
+	draw := func(bg *Background) image.Image {
+		dc := gg.NewContext(canvas.Dx(), canvas.Dy())
+		dc.SetColor(color.White)
+		dc.Clear()
+		bg.draw(dc, box)
+		return dc.Image()
+	}
+	gray := func(img image.Image, x, y int) uint8 {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+	}
+	inside := image.Pt(box.Bounds.Min.X+1, (box.Bounds.Min.Y+box.Bounds.Max.Y)/2)
+	outsideX := image.Pt(2, inside.Y)
+	above := image.Pt(inside.X, box.Bounds.Min.Y-int(box.FontSize*0.2)-2)
+
+	img := draw(&Background{Style: BackgroundBox})
+	assert.InDelta(t, 128, gray(img, inside.X, inside.Y), 2)
+	assert.Equal(t, uint8(0xff), gray(img, outsideX.X, outsideX.Y), "box does not span the width")
+	assert.Equal(t, uint8(0xff), gray(img, above.X, above.Y), "box ends at the padding")
+
+	img = draw(&Background{Style: BackgroundBand, Opacity: 1})
+	assert.Equal(t, uint8(0), gray(img, inside.X, inside.Y))
+	assert.Equal(t, uint8(0), gray(img, outsideX.X, outsideX.Y), "band spans the width")
+	assert.Equal(t, uint8(0xff), gray(img, above.X, above.Y))
+
+	// scrimはテキストの範囲で最も濃く、上下の余白で徐々に薄くなる
+	img = draw(&Background{Style: BackgroundScrim, Opacity: 1})
+	assert.Equal(t, uint8(0), gray(img, outsideX.X, outsideX.Y))
+	fading := gray(img, above.X, above.Y)
+	assert.Greater(t, fading, uint8(0))
+	assert.Less(t, fading, uint8(0xff))
+}
@@ -0,0 +1,70 @@
+package lgtm
+
+import (
+	"context"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// BetaFlashDrawer は画像の周りを塗りつぶし、中心から細い光が放射するベタフラッシュを描く
+// 塗りつぶした部分の内側の縁がギザギザになり、中心の画像はそのまま残る
+type BetaFlashDrawer struct {
+	InputPath  string
+	OutputPath string
+	LineCount  int         // 放射する光の本数
+	Color      color.Color // 塗りつぶす色
+	Focus      *Point      // 光が放射する点（nilなら画像の中心）
+	Seed       int64       // 光の配置の乱数シード（0なら描画のたびに変わる）
+	Workers    int         // ConcentrationLinesDrawer.Workersと同じ
+	Limits     Limits      // ConcentrationLinesDrawer.Limitsと同じ
+}
+
+func NewBetaFlashDrawer(inputPath, outputPath string) Drawer {
+	return &BetaFlashDrawer{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		LineCount:  360,
+		Color:      color.Black,
+		Limits:     DefaultLimits,
+	}
+}
+
+func (b *BetaFlashDrawer) Draw() error {
+	return b.DrawContext(context.Background())
+}
+
+func (b *BetaFlashDrawer) DrawContext(ctx context.Context) error {
+	return drawEffect(ctx, b.InputPath, b.OutputPath, "beta", b.Workers, b.Limits, b.Focus, b.drawBetaFlash)
+}
+
+// drawBetaFlash は等間隔に並べた細い三角形を外側で重ねて塗りつぶす
+// 三角形の先端の距離をばらつかせ、先端どうしの隙間を中心から放射する白い光にする
+func (b *BetaFlashDrawer) drawBetaFlash(dc *gg.Context, index int, focus Point) {
+	if b.LineCount <= 0 {
+		return
+	}
+	diagonal := math.Hypot(float64(dc.Width()), float64(dc.Height()))
+	outer := farthestCorner(dc.Width(), dc.Height(), focus) * 1.2
+	// 隣の三角形と外側で重なる幅
+	spread := 2 * math.Pi / float64(b.LineCount) * 3
+
+	rng := frameRand(b.Seed, index)
+
+	dc.SetColor(b.Color)
+	for i := 0; i < b.LineCount; i++ {
+		angle := (float64(i) + rng.Float64()*0.5) * 2 * math.Pi / float64(b.LineCount)
+		// 先端は対角線の0.2〜0.4の距離。ときどき長い光を混ぜる
+		inner := diagonal * (0.2 + rng.Float64()*0.2)
+		if rng.Float64() < 0.15 {
+			inner = diagonal * (0.32 + rng.Float64()*0.15)
+		}
+		dc.NewSubPath()
+		dc.MoveTo(focus.X+math.Cos(angle)*inner, focus.Y+math.Sin(angle)*inner)
+		dc.LineTo(focus.X+math.Cos(angle-spread/2)*outer, focus.Y+math.Sin(angle-spread/2)*outer)
+		dc.LineTo(focus.X+math.Cos(angle+spread/2)*outer, focus.Y+math.Sin(angle+spread/2)*outer)
+		dc.ClosePath()
+		dc.Fill()
+	}
+}
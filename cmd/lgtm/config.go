@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/tMinamiii/lgtm"
+	"gopkg.in/yaml.v3"
+)
+
+// profile は設定ファイルのdefaultsや各プリセットに書ける描画設定
+// 省略された項目はnilのままにして、フラグや他のプロファイルの値を上書きしない
+type profile struct {
+	Text               *string
+	SubText            *string
+	Color              *string
+	Gopher             *bool
+	ConcentrationLines *bool
+	Font               *string
+	Size               *float64
+	SubSize            *float64
+	SubRatio           *float64
+	Background         *string
+	BackgroundColor    *string
+	BackgroundOpacity  *float64
+	Fill               *string
+	Rotate             *float64
+	Arc                *float64
+	WritingMode        *string
+	Emoji              *string
+	Placement          *string
+	Focus              *string
+	Effect             *string
+	EffectAngle        *float64
+	Print              *string
+	Timeout            *time.Duration
+}
+
+// merge はoで指定されている項目をpに上書きする
+func (p *profile) merge(o *profile) {
+	if o == nil {
+		return
+	}
+	if o.Text != nil {
+		p.Text = o.Text
+	}
+	if o.SubText != nil {
+		p.SubText = o.SubText
+	}
+	if o.Color != nil {
+		p.Color = o.Color
+	}
+	if o.Gopher != nil {
+		p.Gopher = o.Gopher
+	}
+	if o.ConcentrationLines != nil {
+		p.ConcentrationLines = o.ConcentrationLines
+	}
+	if o.Font != nil {
+		p.Font = o.Font
+	}
+	if o.Size != nil {
+		p.Size = o.Size
+	}
+	if o.SubSize != nil {
+		p.SubSize = o.SubSize
+	}
+	if o.SubRatio != nil {
+		p.SubRatio = o.SubRatio
+	}
+	if o.Background != nil {
+		p.Background = o.Background
+	}
+	if o.BackgroundColor != nil {
+		p.BackgroundColor = o.BackgroundColor
+	}
+	if o.BackgroundOpacity != nil {
+		p.BackgroundOpacity = o.BackgroundOpacity
+	}
+	if o.Fill != nil {
+		p.Fill = o.Fill
+	}
+	if o.Rotate != nil {
+		p.Rotate = o.Rotate
+	}
+	if o.Arc != nil {
+		p.Arc = o.Arc
+	}
+	if o.WritingMode != nil {
+		p.WritingMode = o.WritingMode
+	}
+	if o.Emoji != nil {
+		p.Emoji = o.Emoji
+	}
+	if o.Placement != nil {
+		p.Placement = o.Placement
+	}
+	if o.Focus != nil {
+		p.Focus = o.Focus
+	}
+	if o.Effect != nil {
+		p.Effect = o.Effect
+	}
+	if o.EffectAngle != nil {
+		p.EffectAngle = o.EffectAngle
+	}
+	if o.Print != nil {
+		p.Print = o.Print
+	}
+	if o.Timeout != nil {
+		p.Timeout = o.Timeout
+	}
+}
+
+// apply はコマンドラインで指定されていないフラグの値をプロファイルの値にする
+func (p *profile) apply(flags *pflag.FlagSet) {
+	override(flags, "text", &customText, p.Text)
+	override(flags, "sub-text", &customSubText, p.SubText)
+	override(flags, "color", &color, p.Color)
+	override(flags, "gopher", &gopher, p.Gopher)
+	override(flags, "concentration-lines", &concentrationLines, p.ConcentrationLines)
+	override(flags, "font", &fontPath, p.Font)
+	override(flags, "size", &textSize, p.Size)
+	override(flags, "sub-size", &subTextSize, p.SubSize)
+	override(flags, "sub-ratio", &subTextRatio, p.SubRatio)
+	override(flags, "background", &backgroundStyle, p.Background)
+	override(flags, "background-color", &backgroundColor, p.BackgroundColor)
+	override(flags, "background-opacity", &backgroundOpacity, p.BackgroundOpacity)
+	override(flags, "fill", &textFill, p.Fill)
+	override(flags, "rotate", &textRotation, p.Rotate)
+	override(flags, "arc", &textArc, p.Arc)
+	override(flags, "writing-mode", &writingMode, p.WritingMode)
+	override(flags, "emoji", &emojiPath, p.Emoji)
+	override(flags, "placement", &placement, p.Placement)
+	override(flags, "focus", &focus, p.Focus)
+	override(flags, "effect", &effect, p.Effect)
+	override(flags, "effect-angle", &effectAngle, p.EffectAngle)
+	override(flags, "print", &printFormat, p.Print)
+	override(flags, "timeout", &timeout, p.Timeout)
+}
+
+func override[T any](flags *pflag.FlagSet, name string, dst, value *T) {
+	if value != nil && !flags.Changed(name) {
+		*dst = *value
+	}
+}
+
+// config は設定ファイルの内容
+type config struct {
+	Defaults profile
+	Presets  map[string]*profile
+}
+
+// resolve はdefaultsにプリセットを重ねた設定を返す
+func (c *config) resolve(preset string) (*profile, error) {
+	p := &profile{}
+	p.merge(&c.Defaults)
+	if preset == "" {
+		return p, nil
+	}
+
+	pp, ok := c.Presets[preset]
+	if !ok {
+		names := make([]string, 0, len(c.Presets))
+		for name := range c.Presets {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unknown preset %q: no presets are defined", preset)
+		}
+		return nil, fmt.Errorf("unknown preset %q: must be one of %s", preset, strings.Join(names, ", "))
+	}
+	p.merge(pp)
+	return p, nil
+}
+
+// configError は設定ファイルの誤りを行番号とキーの位置付きで表す
+type configError struct {
+	path string
+	line int
+	key  string
+	err  error
+}
+
+func (e *configError) Error() string {
+	if e.key == "" {
+		return fmt.Sprintf("%s:%d: %v", e.path, e.line, e.err)
+	}
+	return fmt.Sprintf("%s:%d: %s: %v", e.path, e.line, e.key, e.err)
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// defaultConfigPath は ~/.config/lgtm/config.yaml（$XDG_CONFIG_HOMEがあればその下）を返す
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lgtm", "config.yaml"), nil
+}
+
+// loadConfig は設定ファイルを読み込む
+// 明示的に指定されていないデフォルトの設定ファイルは、存在しなければ空の設定として扱う
+func loadConfig(path string, explicit bool) (*config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(path, data)
+}
+
+func parseConfig(path string, data []byte) (*config, error) {
+	c := &config{}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(root.Content) == 0 {
+		return c, nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, &configError{path: path, line: doc.Line, err: errors.New("must be a mapping")}
+	}
+
+	// 相対パスのフォント・模様・絵文字は設定ファイルのディレクトリを基準にする
+	d := &profileDecoder{path: path, dir: filepath.Dir(path)}
+	for i := 0; i < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		switch key.Value {
+		case "defaults":
+			p, err := d.decode("defaults", value)
+			if err != nil {
+				return nil, err
+			}
+			c.Defaults = *p
+
+		case "presets":
+			if value.Kind != yaml.MappingNode {
+				return nil, &configError{path: path, line: value.Line, key: "presets", err: errors.New("must be a mapping of preset names")}
+			}
+			c.Presets = make(map[string]*profile, len(value.Content)/2)
+			for j := 0; j < len(value.Content); j += 2 {
+				name := value.Content[j].Value
+				p, err := d.decode("presets."+name, value.Content[j+1])
+				if err != nil {
+					return nil, err
+				}
+				c.Presets[name] = p
+			}
+
+		default:
+			return nil, &configError{path: path, line: key.Line, key: key.Value, err: errors.New("unknown key: must be 'defaults' or 'presets'")}
+		}
+	}
+	return c, nil
+}
+
+// profileDecoder はYAMLのマッピングをprofileに変換し、誤りのあるキーを報告する
+type profileDecoder struct {
+	path string
+	dir  string
+}
+
+// profileKeys はプロファイルに書けるキー
+var profileKeys = []string{
+	"text", "sub_text", "color", "gopher", "concentration_lines", "font", "size", "sub_size", "sub_ratio",
+	"background", "background_color", "background_opacity", "fill", "rotate", "arc", "writing_mode", "emoji",
+	"placement", "focus", "effect", "effect_angle", "print", "timeout",
+}
+
+func (d *profileDecoder) decode(name string, node *yaml.Node) (*profile, error) {
+	p := &profile{}
+	// 空のプリセットはすべての項目を省略したものとして扱う
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return p, nil
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, &configError{path: d.path, line: node.Line, key: name, err: errors.New("must be a mapping")}
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if err := d.decodeField(p, key.Value, value); err != nil {
+			line := value.Line
+			if errors.Is(err, errUnknownKey) {
+				line = key.Line
+			}
+			return nil, &configError{path: d.path, line: line, key: name + "." + key.Value, err: err}
+		}
+	}
+	return p, nil
+}
+
+var errUnknownKey = fmt.Errorf("unknown key: must be one of %s", strings.Join(profileKeys, ", "))
+
+func (d *profileDecoder) decodeField(p *profile, key string, value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return errors.New("must be a scalar value")
+	}
+
+	var err error
+	switch key {
+	case "text":
+		p.Text = &value.Value
+	case "sub_text":
+		p.SubText = &value.Value
+	case "color":
+		if value.Value != "white" && value.Value != "black" {
+			return fmt.Errorf("invalid value %q: must be 'white' or 'black'", value.Value)
+		}
+		p.Color = &value.Value
+	case "gopher":
+		p.Gopher, err = decodeBool(value)
+	case "concentration_lines":
+		p.ConcentrationLines, err = decodeBool(value)
+	case "font":
+		font := expandPath(value.Value, d.dir)
+		p.Font = &font
+	case "size":
+		p.Size, err = decodeSize(value)
+	case "sub_size":
+		p.SubSize, err = decodeSize(value)
+	case "sub_ratio":
+		p.SubRatio, err = decodeSize(value)
+	case "background":
+		if value.Value != "" && !slices.Contains(lgtm.BackgroundStyles, lgtm.BackgroundStyle(value.Value)) {
+			return fmt.Errorf("invalid value %q: must be 'box', 'band' or 'scrim'", value.Value)
+		}
+		p.Background = &value.Value
+	case "background_color":
+		if _, err := lgtm.ParseColor(value.Value); err != nil {
+			return fmt.Errorf("invalid value %q: %w", value.Value, err)
+		}
+		p.BackgroundColor = &value.Value
+	case "background_opacity":
+		p.BackgroundOpacity, err = decodeNumber(value, func(f float64) bool { return f > 0 && f <= 1 }, "greater than 0 and at most 1")
+	case "fill":
+		// 模様の画像は描画時に読み込むため、ここではパスだけを展開する
+		fill := value.Value
+		if path, ok := strings.CutPrefix(fill, "pattern:"); ok {
+			fill = "pattern:" + expandPath(path, d.dir)
+		} else if fill != "" {
+			if _, err := lgtm.ParseFill(fill); err != nil {
+				return err
+			}
+		}
+		p.Fill = &fill
+	case "rotate":
+		p.Rotate, err = decodeNumber(value, func(float64) bool { return true }, "a number of degrees")
+	case "arc":
+		p.Arc, err = decodeNumber(value, func(f float64) bool { return f >= -360 && f <= 360 }, "between -360 and 360")
+	case "writing_mode":
+		if value.Value != "horizontal" && value.Value != "vertical" && value.Value != "auto" {
+			return fmt.Errorf("invalid value %q: must be 'horizontal', 'vertical' or 'auto'", value.Value)
+		}
+		p.WritingMode = &value.Value
+	case "emoji":
+		emoji := expandPath(value.Value, d.dir)
+		p.Emoji = &emoji
+	case "placement":
+		if value.Value != "default" && value.Value != "smart" {
+			return fmt.Errorf("invalid value %q: must be 'default' or 'smart'", value.Value)
+		}
+		p.Placement = &value.Value
+	case "focus":
+		if value.Value != "auto" {
+			if _, err := parseFocus(value.Value); err != nil {
+				return fmt.Errorf("invalid value %q: must be 'center', 'auto' or 'x,y' in pixels", value.Value)
+			}
+		}
+		p.Focus = &value.Value
+	case "effect":
+		if value.Value != "" && !slices.Contains(lgtm.Effects, lgtm.Effect(value.Value)) {
+			return fmt.Errorf("invalid value %q: must be 'concentration', 'speed', 'beta', 'screentone' or 'burst'", value.Value)
+		}
+		p.Effect = &value.Value
+	case "effect_angle":
+		p.EffectAngle, err = decodeNumber(value, func(float64) bool { return true }, "a number of degrees")
+	case "print":
+		if err := validatePrintFormat(value.Value); err != nil {
+			return fmt.Errorf("invalid value %q: must be one of %s", value.Value, strings.Join(printFormats, ", "))
+		}
+		p.Print = &value.Value
+	case "timeout":
+		t, perr := time.ParseDuration(value.Value)
+		if perr != nil || t < 0 {
+			return fmt.Errorf("invalid value %q: must be a duration such as '30s'", value.Value)
+		}
+		p.Timeout = &t
+	default:
+		return errUnknownKey
+	}
+	return err
+}
+
+func decodeBool(value *yaml.Node) (*bool, error) {
+	var b bool
+	if err := value.Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid value %q: must be true or false", value.Value)
+	}
+	return &b, nil
+}
+
+func decodeSize(value *yaml.Node) (*float64, error) {
+	return decodeNumber(value, func(f float64) bool { return f >= 0 }, "a non-negative number")
+}
+
+// decodeNumber はvalidを満たす有限の数を読み取る。wantは誤りのときに示す値の範囲
+func decodeNumber(value *yaml.Node, valid func(float64) bool, want string) (*float64, error) {
+	var f float64
+	if err := value.Decode(&f); err != nil || math.IsNaN(f) || math.IsInf(f, 0) || !valid(f) {
+		return nil, fmt.Errorf("invalid value %q: must be %s", value.Value, want)
+	}
+	return &f, nil
+}
+
+// expandPath は~をホームディレクトリに、相対パスをdirからのパスに展開する
+func expandPath(path, dir string) string {
+	if path == "" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// applyConfig は設定ファイルとプリセットの値を、コマンドラインで指定されていないフラグに反映する
+func applyConfig(flags *pflag.FlagSet, path, preset string) error {
+	explicit := path != ""
+	if !explicit {
+		var err error
+		if path, err = defaultConfigPath(); err != nil {
+			// ホームディレクトリがない環境では設定ファイルを使わない
+			if preset == "" {
+				return nil
+			}
+			return err
+		}
+	}
+
+	c, err := loadConfig(path, explicit)
+	if err != nil {
+		return err
+	}
+	p, err := c.resolve(preset)
+	if err != nil {
+		return err
+	}
+	p.apply(flags)
+	return nil
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tMinamiii/lgtm"
+)
+
+const testConfig = `defaults:
+  color: black
+  print: path
+presets:
+  ship-it:
+    text: SHIP IT
+    sub_text: Ship it!
+    concentration_lines: true
+    font: fonts/custom.otf
+    sub_ratio: 0.4
+    timeout: 1m
+  manga:
+    effect: speed
+    effect_angle: -20
+    background: box
+    background_opacity: 0.8
+    fill: pattern:textures/dots.png
+    emoji: emoji
+    writing_mode: auto
+  quiet:
+`
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig("/etc/lgtm/config.yaml", []byte(testConfig))
+	require.NoError(t, err)
+
+	assert.Equal(t, "black", *c.Defaults.Color)
+	assert.Equal(t, "path", *c.Defaults.Print)
+	assert.Nil(t, c.Defaults.Text)
+	require.Contains(t, c.Presets, "ship-it")
+	require.Contains(t, c.Presets, "quiet")
+
+	p, err := c.resolve("ship-it")
+	require.NoError(t, err)
+	assert.Equal(t, "SHIP IT", *p.Text)
+	assert.Equal(t, "Ship it!", *p.SubText)
+	assert.Equal(t, "black", *p.Color)
+	assert.True(t, *p.ConcentrationLines)
+	assert.Equal(t, filepath.Join("/etc/lgtm", "fonts/custom.otf"), *p.Font)
+	assert.Equal(t, 0.4, *p.SubRatio)
+	assert.Equal(t, time.Minute, *p.Timeout)
+	assert.Nil(t, p.Gopher)
+	assert.Nil(t, p.Size)
+
+	p, err = c.resolve("manga")
+	require.NoError(t, err)
+	assert.Equal(t, "speed", *p.Effect)
+	assert.Equal(t, -20.0, *p.EffectAngle)
+	assert.Equal(t, "box", *p.Background)
+	assert.Equal(t, 0.8, *p.BackgroundOpacity)
+	assert.Equal(t, "pattern:"+filepath.Join("/etc/lgtm", "textures/dots.png"), *p.Fill)
+	assert.Equal(t, filepath.Join("/etc/lgtm", "emoji"), *p.Emoji)
+	assert.Equal(t, "auto", *p.WritingMode)
+	assert.Nil(t, p.Focus)
+
+	p, err = c.resolve("quiet")
+	require.NoError(t, err)
+	assert.Equal(t, &profile{Color: c.Defaults.Color, Print: c.Defaults.Print}, p)
+
+	_, err = c.resolve("missing")
+	assert.EqualError(t, err, `unknown preset "missing": must be one of manga, quiet, ship-it`)
+
+	empty, err := parseConfig("config.yaml", nil)
+	require.NoError(t, err)
+	_, err = empty.resolve("ship-it")
+	assert.EqualError(t, err, `unknown preset "ship-it": no presets are defined`)
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{
+			name: "unknown top-level key",
+			yaml: "defaults:\n  color: black\npreset:\n  a: {}\n",
+			want: "config.yaml:3: preset: unknown key: must be 'defaults' or 'presets'",
+		},
+		{
+			name: "unknown profile key",
+			yaml: "presets:\n  ship-it:\n    text: SHIP IT\n    colour: black\n",
+			want: "config.yaml:4: presets.ship-it.colour: unknown key: must be one of text, sub_text, color, gopher, concentration_lines, font, size, sub_size, sub_ratio, " +
+				"background, background_color, background_opacity, fill, rotate, arc, writing_mode, emoji, placement, focus, effect, effect_angle, print, timeout",
+		},
+		{
+			name: "invalid color",
+			yaml: "defaults:\n  color: red\n",
+			want: `config.yaml:2: defaults.color: invalid value "red": must be 'white' or 'black'`,
+		},
+		{
+			name: "invalid bool",
+			yaml: "presets:\n  a:\n    concentration_lines: maybe\n",
+			want: `config.yaml:3: presets.a.concentration_lines: invalid value "maybe": must be true or false`,
+		},
+		{
+			name: "invalid timeout",
+			yaml: "defaults:\n  timeout: soon\n",
+			want: `config.yaml:2: defaults.timeout: invalid value "soon": must be a duration such as '30s'`,
+		},
+		{
+			name: "invalid size",
+			yaml: "defaults:\n  sub_size: -3\n",
+			want: `config.yaml:2: defaults.sub_size: invalid value "-3": must be a non-negative number`,
+		},
+		{
+			name: "invalid background",
+			yaml: "defaults:\n  background: circle\n",
+			want: `config.yaml:2: defaults.background: invalid value "circle": must be 'box', 'band' or 'scrim'`,
+		},
+		{
+			name: "invalid background opacity",
+			yaml: "defaults:\n  background_opacity: 0\n",
+			want: `config.yaml:2: defaults.background_opacity: invalid value "0": must be greater than 0 and at most 1`,
+		},
+		{
+			name: "invalid fill",
+			yaml: "defaults:\n  fill: conic:#fff,#000\n",
+			want: `config.yaml:2: defaults.fill: invalid fill "conic:#fff,#000": must be a color or one of solid, linear, vertical, radial, pattern followed by ':'`,
+		},
+		{
+			name: "arc out of range",
+			yaml: "defaults:\n  arc: 400\n",
+			want: `config.yaml:2: defaults.arc: invalid value "400": must be between -360 and 360`,
+		},
+		{
+			name: "invalid writing mode",
+			yaml: "defaults:\n  writing_mode: diagonal\n",
+			want: `config.yaml:2: defaults.writing_mode: invalid value "diagonal": must be 'horizontal', 'vertical' or 'auto'`,
+		},
+		{
+			name: "invalid focus",
+			yaml: "defaults:\n  focus: left\n",
+			want: `config.yaml:2: defaults.focus: invalid value "left": must be 'center', 'auto' or 'x,y' in pixels`,
+		},
+		{
+			name: "invalid effect",
+			yaml: "defaults:\n  effect: sparkle\n",
+			want: `config.yaml:2: defaults.effect: invalid value "sparkle": must be 'concentration', 'speed', 'beta', 'screentone' or 'burst'`,
+		},
+		{
+			name: "invalid print",
+			yaml: "defaults:\n  print: xml\n",
+			want: `config.yaml:2: defaults.print: invalid value "xml": must be one of markdown, html, path, json`,
+		},
+		{
+			name: "non-scalar value",
+			yaml: "defaults:\n  text:\n    - a\n",
+			want: "config.yaml:3: defaults.text: must be a scalar value",
+		},
+		{
+			name: "presets not a mapping",
+			yaml: "presets: [a]\n",
+			want: "config.yaml:1: presets: must be a mapping of preset names",
+		},
+		{
+			name: "document not a mapping",
+			yaml: "- a\n",
+			want: "config.yaml:1: must be a mapping",
+		},
+		{
+			name: "syntax error",
+			yaml: "defaults: [\n",
+			want: "config.yaml: yaml: line 1: did not find expected node content",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseConfig("config.yaml", []byte(tt.yaml))
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "config.yaml")
+
+	c, err := loadConfig(missing, false)
+	require.NoError(t, err)
+	assert.Empty(t, c.Presets)
+
+	_, err = loadConfig(missing, true)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestProfile_Apply(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	var c string
+	flags.StringVar(&c, "color", "white", "")
+	require.NoError(t, flags.Parse([]string{"--color", "white"}))
+
+	customText = ""
+	color = "white"
+	concentrationLines = false
+	text, black, lines := "SHIP IT", "black", true
+	p := &profile{Text: &text, Color: &black, ConcentrationLines: &lines}
+	p.apply(flags)
+
+	// コマンドラインで指定されたフラグは設定ファイルより優先される
+	assert.Equal(t, "white", color)
+	assert.Equal(t, "SHIP IT", customText)
+	assert.True(t, concentrationLines)
+	concentrationLines = false
+}
+
+func TestRootCmd_Preset(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lgtm"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lgtm", "config.yaml"), []byte(`defaults:
+  print: json
+presets:
+  ship-it:
+    text: SHIP IT
+    sub_text: Ship it!
+    color: black
+  manga:
+    effect: burst
+    focus: 10,20
+    background: box
+`), 0o644))
+	explicit := filepath.Join(dir, "other.yaml")
+	require.NoError(t, os.WriteFile(explicit, []byte("defaults:\n  text: OTHER\n  print: json\n"), 0o644))
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantAlt   string
+		wantFocus *focusPoint
+		wantCode  int
+	}{
+		{
+			name:    "defaults",
+			args:    nil,
+			wantAlt: "LGTM - Looks Good To Me",
+		},
+		{
+			name:    "preset",
+			args:    []string{"--preset", "ship-it"},
+			wantAlt: "SHIP IT - Ship it!",
+		},
+		{
+			name:    "flag overrides preset",
+			args:    []string{"--preset", "ship-it", "-t", "NOPE"},
+			wantAlt: "NOPE - Ship it!",
+		},
+		{
+			name:      "preset with effect and background",
+			args:      []string{"--preset", "manga"},
+			wantAlt:   "LGTM - Looks Good To Me",
+			wantFocus: &focusPoint{X: 10, Y: 20},
+		},
+		{
+			name:     "flag conflicts with preset",
+			args:     []string{"--preset", "manga", "-l"},
+			wantCode: exitUsage,
+		},
+		{
+			name:    "explicit config",
+			args:    []string{"--config", explicit},
+			wantAlt: "OTHER - Looks Good To Me",
+		},
+		{
+			name:     "unknown preset",
+			args:     []string{"--preset", "missing"},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing explicit config",
+			args:     []string{"--config", filepath.Join(dir, "missing.yaml")},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing font",
+			args:     []string{"--font", filepath.Join(dir, "missing.otf")},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "broken font",
+			args:     []string{"--font", explicit},
+			wantCode: exitInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := runRoot(t, tt.args...)
+			require.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode != exitOK {
+				return
+			}
+
+			var got snippet
+			require.NoError(t, json.Unmarshal(r.stdout.Bytes(), &got))
+			assert.Equal(t, tt.wantAlt, got.Alt)
+			assert.Equal(t, tt.wantFocus, got.Focus)
+		})
+	}
+}
+
+func TestRender_Font(t *testing.T) {
+	fontFile := filepath.Join(t.TempDir(), "font.otf")
+	require.NoError(t, os.WriteFile(fontFile, lgtm.NotoSansMono, 0o644))
+
+	output := filepath.Join(t.TempDir(), "out.jpg")
+	_, err := render(t.Context(), renderOptions{InputPath: "testdata/lunch.jpg", OutputPath: output, FontPath: fontFile})
+	require.NoError(t, err)
+	assert.FileExists(t, output)
+}
+
+// resetRootFlags はフラグの値と指定済みの状態を初期値に戻す
+func resetRootFlags() {
+	color = "white"
+	gopher = false
+	concentrationLines = false
+	inputPath = ""
+	outputPath = ""
+	customText = ""
+	customSubText = ""
+	timeout = 0
+	printFormat = ""
+	saveToLibrary = false
+	libraryTags = nil
+	fontPath = ""
+	textSize = 0
+	subTextSize = 0
+	subTextRatio = 0
+	backgroundStyle = ""
+	backgroundColor = "black"
+	backgroundOpacity = 0.5
+	textFill = ""
+	textRotation = 0
+	textArc = 0
+	writingMode = "horizontal"
+	emojiPath = ""
+	placement = "default"
+	focus = "center"
+	effect = ""
+	effectAngle = 0
+	configPath = ""
+	presetName = ""
+	rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		f.Changed = false
+	})
+}
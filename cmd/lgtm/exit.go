@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/tMinamiii/lgtm"
+)
+
+// 終了コード
+const (
+	exitOK       = 0
+	exitInternal = 1 // フォントの読み込みや出力の書き込みなど、内部の失敗
+	exitUsage    = 2 // フラグや入力画像、出力先の誤りなど、ユーザーが直せる失敗
+)
+
+// exitError は描画中のエラーに終了コードを付ける
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// newExitError は描画中のエラーを入力の誤りか内部の失敗かに分類する
+func newExitError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	code := exitInternal
+	switch {
+	case errors.Is(err, lgtm.ErrOutputWrite):
+		// 出力先のディレクトリがない・書き込めない場合は-oの誤りとして扱い、
+		// ディスクの空き不足など、それ以外の書き込みの失敗は内部の失敗とする
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+			code = exitUsage
+		}
+	case errors.Is(err, fs.ErrNotExist),
+		errors.Is(err, lgtm.ErrFetch),
+		errors.Is(err, lgtm.ErrUnsupportedFormat),
+		errors.Is(err, lgtm.ErrDecode),
+		errors.Is(err, lgtm.ErrLimitExceeded),
+		errors.Is(err, lgtm.ErrTextOverflow),
+		errors.Is(err, lgtm.ErrInvalidSpec),
+		errors.Is(err, errEntryNotFound):
+		code = exitUsage
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode はExecuteが返したエラーの終了コードを返す
+// 描画まで到達しなかったエラーはフラグや引数の誤りとして扱う
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var e *exitError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return exitUsage
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	mathrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// libraryIndex はライブラリのディレクトリに置くメタデータのファイル名
+const libraryIndex = "index.json"
+
+// errEntryNotFound はIDやタグに一致する画像がライブラリにない場合のエラー
+var errEntryNotFound = errors.New("no matching image in library")
+
+// libraryEntry はライブラリに保存した画像1枚分のメタデータ
+type libraryEntry struct {
+	ID                 string    `json:"id"`
+	File               string    `json:"file"`
+	Source             string    `json:"source,omitempty"`
+	Text               string    `json:"text,omitempty"`
+	SubText            string    `json:"sub_text,omitempty"`
+	Mode               string    `json:"mode"`
+	ConcentrationLines bool      `json:"concentration_lines,omitempty"`
+	Tags               []string  `json:"tags"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// hasTags はエントリが指定されたタグをすべて持っているかどうかを判定する
+func (e *libraryEntry) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(e.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// renderOptions はスニペットの代替テキストを作るための描画設定を返す
+func (e *libraryEntry) renderOptions() renderOptions {
+	return renderOptions{
+		Text:               e.Text,
+		SubText:            e.SubText,
+		Gopher:             e.Mode == "gopher",
+		ConcentrationLines: e.ConcentrationLines,
+	}
+}
+
+// library は画像ファイルとindex.jsonを置いたローカルのディレクトリ
+type library struct {
+	dir     string
+	Entries []*libraryEntry `json:"entries"`
+}
+
+// libraryDir はライブラリのディレクトリを返す
+// LGTM_LIBRARY_DIR、$XDG_DATA_HOME/lgtm/library、~/.local/share/lgtm/library の順に決める
+func libraryDir() (string, error) {
+	if dir := os.Getenv("LGTM_LIBRARY_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "lgtm", "library"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "lgtm", "library"), nil
+}
+
+// openLibrary はライブラリのインデックスを読み込む
+// ディレクトリやインデックスがまだない場合は空のライブラリを返す
+func openLibrary() (*library, error) {
+	dir, err := libraryDir()
+	if err != nil {
+		return nil, err
+	}
+	l := &library{dir: dir}
+
+	data, err := os.ReadFile(filepath.Join(dir, libraryIndex))
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, libraryIndex), err)
+	}
+	return l, nil
+}
+
+// save はインデックスを一時ファイルに書き込んでから置き換える
+func (l *library) save() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(l.dir, libraryIndex+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(l.dir, libraryIndex))
+}
+
+// path はエントリの画像ファイルのパスを返す
+func (l *library) path(e *libraryEntry) string {
+	return filepath.Join(l.dir, e.File)
+}
+
+// add は画像をライブラリのディレクトリにコピーし、エントリを登録する
+func (l *library) add(src string, e *libraryEntry) error {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+
+	id, err := newLibraryID()
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	e.File = id + strings.ToLower(filepath.Ext(src))
+	e.Tags = normalizeTags(e.Tags)
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+
+	if err := copyFile(src, l.path(e)); err != nil {
+		return err
+	}
+	l.Entries = append(l.Entries, e)
+	if err := l.save(); err != nil {
+		os.Remove(l.path(e))
+		return err
+	}
+	return nil
+}
+
+// find はIDに一致するエントリを返す
+func (l *library) find(id string) (*libraryEntry, error) {
+	for _, e := range l.Entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: id %q", errEntryNotFound, id)
+}
+
+// remove はエントリと画像ファイルを削除する
+func (l *library) remove(id string) error {
+	e, err := l.find(id)
+	if err != nil {
+		return err
+	}
+	l.Entries = slices.DeleteFunc(l.Entries, func(x *libraryEntry) bool { return x == e })
+	if err := l.save(); err != nil {
+		return err
+	}
+	if err := os.Remove(l.path(e)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// filter は指定されたタグをすべて持つエントリを返す
+func (l *library) filter(tags []string) []*libraryEntry {
+	tags = normalizeTags(tags)
+	var entries []*libraryEntry
+	for _, e := range l.Entries {
+		if e.hasTags(tags) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// newLibraryID はエントリのIDとして8桁の16進数を生成する
+func newLibraryID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// normalizeTags はタグを小文字にそろえ、空のタグと重複を取り除いて並べ替える
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+var (
+	libraryAddSource             string
+	libraryAddText               string
+	libraryAddSubText            string
+	libraryAddMode               string
+	libraryAddConcentrationLines bool
+	libraryAddTags               []string
+	libraryListTags              []string
+	libraryTagRemove             bool
+)
+
+var libraryCmd = &cobra.Command{
+	Use:   "library",
+	Short: "Manage a local library of LGTM images",
+	Long: `Manage a local library of generated LGTM images with tags.
+
+Images and their metadata (source, text, mode, tags, created time) are stored in
+$LGTM_LIBRARY_DIR, or $XDG_DATA_HOME/lgtm/library (~/.local/share/lgtm/library)
+when it is not set.`,
+}
+
+var libraryAddCmd = &cobra.Command{
+	Use:   "add <image>",
+	Short: "Add an image to the library",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if libraryAddMode != "text" && libraryAddMode != "gopher" {
+			return fmt.Errorf("invalid --mode %q: must be 'text' or 'gopher'", libraryAddMode)
+		}
+		cmd.SilenceUsage = true
+
+		e := &libraryEntry{
+			Source:             libraryAddSource,
+			Text:               libraryAddText,
+			SubText:            libraryAddSubText,
+			Mode:               libraryAddMode,
+			ConcentrationLines: libraryAddConcentrationLines,
+			Tags:               libraryAddTags,
+		}
+		if err := addToLibrary(args[0], e); err != nil {
+			return newExitError(err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), e.ID)
+		return nil
+	},
+}
+
+var libraryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List images in the library",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		l, err := openLibrary()
+		if err != nil {
+			return newExitError(err)
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTAGS\tMODE\tTEXT\tCREATED\tPATH")
+		for _, e := range l.filter(libraryListTags) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.ID, strings.Join(e.Tags, ","), e.Mode, altText(e.renderOptions()),
+				e.CreatedAt.Local().Format(time.DateTime), l.path(e))
+		}
+		return w.Flush()
+	},
+}
+
+var libraryTagCmd = &cobra.Command{
+	Use:   "tag <id> <tag>...",
+	Short: "Add tags to (or remove them from) a library image",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		l, err := openLibrary()
+		if err != nil {
+			return newExitError(err)
+		}
+		e, err := l.find(args[0])
+		if err != nil {
+			return newExitError(err)
+		}
+		tags := normalizeTags(args[1:])
+		if libraryTagRemove {
+			e.Tags = slices.DeleteFunc(e.Tags, func(tag string) bool { return slices.Contains(tags, tag) })
+		} else {
+			e.Tags = normalizeTags(append(e.Tags, tags...))
+		}
+		if err := l.save(); err != nil {
+			return newExitError(err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), strings.Join(e.Tags, ","))
+		return nil
+	},
+}
+
+var libraryRmCmd = &cobra.Command{
+	Use:   "rm <id>...",
+	Short: "Remove images from the library",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		l, err := openLibrary()
+		if err != nil {
+			return newExitError(err)
+		}
+		for _, id := range args {
+			if err := l.remove(id); err != nil {
+				return newExitError(err)
+			}
+		}
+		return nil
+	},
+}
+
+// newRandomCmd はタグに一致する画像をランダムに1枚選ぶコマンドを作る
+// lgtm random と lgtm library random の両方で使うため、コマンドごとにフラグを持つ
+func newRandomCmd() *cobra.Command {
+	var (
+		tags   []string
+		format string
+	)
+	cmd := &cobra.Command{
+		Use:   "random",
+		Short: "Print a random image from the library",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "" {
+				format = "path"
+			}
+			if err := validatePrintFormat(format); err != nil {
+				return err
+			}
+			cmd.SilenceUsage = true
+
+			l, err := openLibrary()
+			if err != nil {
+				return newExitError(err)
+			}
+			entries := l.filter(tags)
+			if len(entries) == 0 {
+				return newExitError(fmt.Errorf("%w: tags %q", errEntryNotFound, strings.Join(tags, ",")))
+			}
+			e := entries[mathrand.IntN(len(entries))]
+			return newExitError(printSnippet(cmd.OutOrStdout(), format, l.path(e), e.renderOptions()))
+		},
+	}
+	cmd.Flags().StringSliceVar(&tags, "tag", nil, "only pick images with all of these tags (optional)")
+	cmd.Flags().StringVar(&format, "print", "path", "output format: 'markdown', 'html', 'path' or 'json' (optional)")
+	return cmd
+}
+
+// addToLibrary は画像をライブラリに登録する
+func addToLibrary(path string, e *libraryEntry) error {
+	l, err := openLibrary()
+	if err != nil {
+		return err
+	}
+	return l.add(path, e)
+}
+
+func init() {
+	libraryAddCmd.Flags().StringVar(&libraryAddSource, "source", "", "source image path or URL the image was made from (optional)")
+	libraryAddCmd.Flags().StringVarP(&libraryAddText, "text", "t", "", "main text embedded in the image (optional)")
+	libraryAddCmd.Flags().StringVarP(&libraryAddSubText, "sub-text", "s", "", "sub-text embedded in the image (optional)")
+	libraryAddCmd.Flags().StringVar(&libraryAddMode, "mode", "text", "mode the image was made with: 'text' or 'gopher' (optional)")
+	libraryAddCmd.Flags().BoolVarP(&libraryAddConcentrationLines, "concentration-lines", "l", false, "the image has concentration lines (optional)")
+	libraryAddCmd.Flags().StringSliceVar(&libraryAddTags, "tag", nil, "tags for the image, repeatable or comma separated (optional)")
+	libraryListCmd.Flags().StringSliceVar(&libraryListTags, "tag", nil, "only list images with all of these tags (optional)")
+	libraryTagCmd.Flags().BoolVar(&libraryTagRemove, "remove", false, "remove the tags instead of adding them")
+
+	libraryCmd.AddCommand(libraryAddCmd, libraryListCmd, libraryTagCmd, libraryRmCmd, newRandomCmd())
+	rootCmd.AddCommand(libraryCmd, newRandomCmd())
+}
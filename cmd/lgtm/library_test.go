@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibrary(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "library")
+	t.Setenv("LGTM_LIBRARY_DIR", dir)
+
+	l, err := openLibrary()
+	require.NoError(t, err)
+	assert.Empty(t, l.Entries)
+
+	cat := &libraryEntry{Source: "cat.jpg", Mode: "text", Text: "SHIP IT", Tags: []string{"Cats", " funny ", "cats", ""}}
+	require.NoError(t, l.add("testdata/lunch.jpg", cat))
+	dog := &libraryEntry{Source: "dog.jpg", Mode: "gopher", Tags: []string{"dogs"}}
+	require.NoError(t, l.add("testdata/lunch.jpg", dog))
+
+	assert.Len(t, cat.ID, 8)
+	assert.NotEqual(t, cat.ID, dog.ID)
+	assert.Equal(t, []string{"cats", "funny"}, cat.Tags)
+	assert.Equal(t, cat.ID+".jpg", cat.File)
+	assert.FileExists(t, l.path(cat))
+	assert.False(t, cat.CreatedAt.IsZero())
+
+	// インデックスから読み直しても同じ内容になる
+	l, err = openLibrary()
+	require.NoError(t, err)
+	require.Len(t, l.Entries, 2)
+	assert.Equal(t, cat.ID, l.Entries[0].ID)
+	assert.Equal(t, "SHIP IT", l.Entries[0].Text)
+	assert.True(t, cat.CreatedAt.Equal(l.Entries[0].CreatedAt))
+
+	assert.Len(t, l.filter(nil), 2)
+	assert.Len(t, l.filter([]string{"CATS"}), 1)
+	assert.Len(t, l.filter([]string{"cats", "dogs"}), 0)
+
+	_, err = l.find("missing")
+	assert.ErrorIs(t, err, errEntryNotFound)
+
+	require.NoError(t, l.remove(cat.ID))
+	assert.NoFileExists(t, filepath.Join(dir, cat.File))
+	l, err = openLibrary()
+	require.NoError(t, err)
+	require.Len(t, l.Entries, 1)
+	assert.Equal(t, dog.ID, l.Entries[0].ID)
+
+	assert.ErrorIs(t, l.remove(cat.ID), errEntryNotFound)
+}
+
+func TestLibrary_BrokenIndex(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LGTM_LIBRARY_DIR", dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, libraryIndex), []byte("{"), 0o644))
+
+	_, err := openLibrary()
+	assert.ErrorContains(t, err, libraryIndex)
+}
+
+func TestLibraryDir(t *testing.T) {
+	t.Setenv("LGTM_LIBRARY_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "/data")
+	dir, err := libraryDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/data", "lgtm", "library"), dir)
+
+	t.Setenv("LGTM_LIBRARY_DIR", "/custom")
+	dir, err = libraryDir()
+	require.NoError(t, err)
+	assert.Equal(t, "/custom", dir)
+}
+
+func TestLibraryCmd(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LGTM_LIBRARY_DIR", dir)
+
+	run := func(args ...string) (string, error) {
+		t.Helper()
+		var buf bytes.Buffer
+		rootCmd.SetArgs(args)
+		rootCmd.SetOut(&buf)
+		rootCmd.SetErr(io.Discard)
+		defer rootCmd.SetArgs(nil)
+		err := rootCmd.Execute()
+		return buf.String(), err
+	}
+
+	// 描画した画像を--saveでライブラリに追加する
+	color = "white"
+	gopher = false
+	concentrationLines = false
+	customText = "SHIP IT"
+	customSubText = ""
+	timeout = 0
+	printFormat = ""
+	saveToLibrary = false
+	libraryTags = nil
+	_, err := run("-i", "testdata/lunch.jpg", "-o", filepath.Join(t.TempDir(), "out.jpg"), "-t", "SHIP IT", "--save", "--tag", "cats,Ship")
+	require.NoError(t, err)
+	resetRootFlags()
+
+	out, err := run("library", "add", "testdata/lunch.jpg", "--mode", "gopher", "--tag", "dogs")
+	require.NoError(t, err)
+	dogID := strings.TrimSpace(out)
+
+	l, err := openLibrary()
+	require.NoError(t, err)
+	require.Len(t, l.Entries, 2)
+	cat := l.Entries[0]
+	assert.Equal(t, "testdata/lunch.jpg", cat.Source)
+	assert.Equal(t, "SHIP IT", cat.Text)
+	assert.Equal(t, "text", cat.Mode)
+	assert.Equal(t, []string{"cats", "ship"}, cat.Tags)
+	assert.Equal(t, dogID, l.Entries[1].ID)
+
+	out, err = run("random", "--tag", "cats", "--print", "markdown")
+	require.NoError(t, err)
+	assert.Equal(t, "![SHIP IT - Looks Good To Me]("+l.path(cat)+")\n", out)
+
+	out, err = run("library", "random", "--tag", "dogs")
+	require.NoError(t, err)
+	assert.Equal(t, l.path(l.Entries[1])+"\n", out)
+
+	out, err = run("library", "tag", dogID, "Puppies", "funny")
+	require.NoError(t, err)
+	assert.Equal(t, "dogs,funny,puppies\n", out)
+	out, err = run("library", "tag", "--remove", dogID, "funny")
+	require.NoError(t, err)
+	assert.Equal(t, "dogs,puppies\n", out)
+	libraryTagRemove = false
+
+	out, err = run("library", "list", "--tag", "puppies")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	assert.Contains(t, lines[1], dogID)
+	assert.Contains(t, lines[1], "LGTM")
+
+	_, err = run("library", "rm", dogID)
+	require.NoError(t, err)
+	_, err = run("library", "rm", dogID)
+	assert.Equal(t, exitUsage, exitCode(err))
+	assert.ErrorIs(t, err, errEntryNotFound)
+
+	_, err = run("library", "add", "testdata/lunch.jpg", "--mode", "unknown")
+	assert.Equal(t, exitUsage, exitCode(err))
+}
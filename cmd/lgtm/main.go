@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"math"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/tMinamiii/lgtm"
@@ -17,6 +20,28 @@ var (
 	outputPath         string
 	customText         string
 	customSubText      string
+	timeout            time.Duration
+	printFormat        string
+	saveToLibrary      bool
+	libraryTags        []string
+	fontPath           string
+	textSize           float64
+	subTextSize        float64
+	subTextRatio       float64
+	backgroundStyle    string
+	backgroundColor    string
+	backgroundOpacity  float64
+	textFill           string
+	textRotation       float64
+	textArc            float64
+	writingMode        string
+	emojiPath          string
+	placement          string
+	focus              string
+	effect             string
+	effectAngle        float64
+	configPath         string
+	presetName         string
 )
 
 var rootCmd = &cobra.Command{
@@ -25,79 +50,170 @@ var rootCmd = &cobra.Command{
 	Long: `LGTM is a CLI tool that embeds custom text on images with customizable colors.
 It can also embed a gopher image or concentration lines and outputs the result as a JPEG file.
 By default, it embeds "LGTM" as main text and "Looks Good To Me" as sub-text.
-You can customize both using the --text and --sub-text flags.`,
-	Args: cobra.NoArgs,
-	Run: func(cmd *cobra.Command, args []string) {
-		currentInput := inputPath
-		tempOutput := ""
-
-		// テキスト色を決定
-		textColor := lgtm.TextColorWhite
-		if color == "black" {
-			textColor = lgtm.TextColorBlack
-		}
-
-		// 集中線を先に描画（指定されている場合）
-		if concentrationLines {
-			if outputPath == "" {
-				tempOutput = inputPath + ".tmp.jpg"
-			} else {
-				tempOutput = outputPath + ".tmp.jpg"
-			}
-			d := lgtm.NewConcentrationLinesDrawer(currentInput, tempOutput)
-			// 集中線の色をテキスト色と同じに設定
-			if drawer, ok := d.(*lgtm.ConcentrationLinesDrawer); ok {
-				drawer.SetLineColor(textColor.Gray16())
-			}
-			if err := d.Draw(); err != nil {
-				log.Fatal(err)
+You can customize both using the --text and --sub-text flags.
+Default flag values and named presets can be set in ~/.config/lgtm/config.yaml.`,
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// 設定ファイルの値はコマンドラインで指定されていないフラグにだけ反映する
+		if err := applyConfig(cmd.Flags(), configPath, presetName); err != nil {
+			return err
+		}
+		if err := validatePrintFormat(printFormat); err != nil {
+			return err
+		}
+		if cmd.Flags().Changed("tag") && !saveToLibrary {
+			return fmt.Errorf("--tag requires --save")
+		}
+		if err := validateSizes(); err != nil {
+			return err
+		}
+		if err := validateBackground(); err != nil {
+			return err
+		}
+		if math.IsNaN(textRotation) || math.IsInf(textRotation, 0) {
+			return fmt.Errorf("invalid --rotate %v: must be a finite number of degrees", textRotation)
+		}
+		if !(textArc >= -360 && textArc <= 360) {
+			return fmt.Errorf("invalid --arc %v: must be between -360 and 360", textArc)
+		}
+		switch writingMode {
+		case "horizontal", "vertical", "auto":
+		default:
+			return fmt.Errorf("invalid --writing-mode %q: must be 'horizontal', 'vertical' or 'auto'", writingMode)
+		}
+		switch placement {
+		case "default", "smart":
+		default:
+			return fmt.Errorf("invalid --placement %q: must be 'default' or 'smart'", placement)
+		}
+		if placement == "smart" && gopher {
+			return fmt.Errorf("--placement smart cannot be combined with --gopher")
+		}
+		if err := validateEffect(); err != nil {
+			return err
+		}
+		if focus != "auto" {
+			if _, err := parseFocus(focus); err != nil {
+				return err
 			}
-			currentInput = tempOutput
 		}
-
-		// Gopherモードの場合
-		if gopher {
-			d := lgtm.NewGopherDrawer(currentInput, outputPath)
-			if err := d.Draw(); err != nil {
-				log.Fatal(err)
+		if textFill != "" {
+			if _, err := lgtm.ParseFill(textFill); err != nil {
+				return err
 			}
-			// 一時ファイルを削除
-			if tempOutput != "" {
-				os.Remove(tempOutput)
+		}
+		if emojiPath != "" {
+			if _, err := lgtm.LoadEmoji(emojiPath); err != nil {
+				return err
 			}
-			return
 		}
 
-		// テキストを描画（デフォルト動作または集中線の後に描画）
-		mainText := lgtm.DefaultMainText
-		subText := lgtm.DefaultSubText
+		// ここから先のエラーはフラグの誤りではないため、usageは表示しない
+		cmd.SilenceUsage = true
 
-		if customText != "" {
-			mainText = customText
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
 		}
-
-		if customSubText != "" {
-			subText = customSubText
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
 		}
 
-		main := lgtm.NewMainText(mainText, textColor)
-		sub := lgtm.NewSubText(subText, textColor)
+		// URLが指定された場合はダウンロードした一時ファイルを入力にする
+		input := inputPath
+		if lgtm.IsURL(input) {
+			path, cleanup, err := lgtm.FromURL(ctx, input, lgtm.FetchOptions{})
+			if err != nil {
+				return newExitError(err)
+			}
+			defer cleanup()
+			input = path
+		}
 
-		d := lgtm.NewTextDrawer(main, sub, currentInput, outputPath)
-		if err := d.Draw(); err != nil {
-			log.Fatal(err)
+		opts := renderOptions{
+			InputPath:          input,
+			OutputPath:         outputPath,
+			Text:               customText,
+			SubText:            customSubText,
+			Color:              color,
+			Gopher:             gopher,
+			ConcentrationLines: concentrationLines,
+			FontPath:           fontPath,
+			Size:               textSize,
+			SubSize:            subTextSize,
+			SubRatio:           subTextRatio,
+			Background:         backgroundStyle,
+			BackgroundColor:    backgroundColor,
+			BackgroundOpacity:  backgroundOpacity,
+			Fill:               textFill,
+			Rotation:           textRotation,
+			Arc:                textArc,
+			WritingMode:        writingMode,
+			Emoji:              emojiPath,
+			Placement:          placement,
+			Focus:              focus,
+			Effect:             effect,
+			EffectAngle:        effectAngle,
+		}
+		// 指定した効果の中心は画像の中になければならない
+		if point, _ := parseFocus(focus); point != nil && opts.focused() {
+			info, err := lgtm.Describe(input)
+			if err != nil {
+				return newExitError(err)
+			}
+			if point.X > float64(info.Width) || point.Y > float64(info.Height) {
+				return fmt.Errorf("invalid --focus %q: outside the %dx%d image", focus, info.Width, info.Height)
+			}
+		}
+		// 推定した効果の中心を表示し、--focusで調整できるようにする
+		if opts.focused() && focus == "auto" {
+			saliency, err := lgtm.LoadSaliency(input)
+			if err != nil {
+				return newExitError(err)
+			}
+			opts.Focus = formatFocus(saliency.Focus())
+			name := "concentration lines"
+			if e := opts.effect(); e != lgtm.EffectConcentration {
+				name = string(e) + " effect"
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s focus: %s (adjust with --focus)\n", name, opts.Focus)
+		}
+		path, err := render(ctx, opts)
+		if err != nil {
+			return newExitError(err)
 		}
 
-		// 一時ファイルを削除
-		if tempOutput != "" {
-			os.Remove(tempOutput)
+		if saveToLibrary {
+			mode := "text"
+			if gopher {
+				mode = "gopher"
+			}
+			e := &libraryEntry{
+				Source:             inputPath,
+				Text:               customText,
+				SubText:            customSubText,
+				Mode:               mode,
+				ConcentrationLines: concentrationLines,
+				Tags:               libraryTags,
+			}
+			if err := addToLibrary(path, e); err != nil {
+				return newExitError(err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "saved to library as %s\n", e.ID)
 		}
+
+		// 出力した画像をレビューに貼り付けられる形式で表示する
+		err = printSnippet(cmd.OutOrStdout(), printFormat, path, opts)
+		return newExitError(err)
 	},
 }
 
 func init() {
 	// Required flags
-	rootCmd.Flags().StringVarP(&inputPath, "input", "i", "", "input image path (required)")
+	rootCmd.Flags().StringVarP(&inputPath, "input", "i", "", "input image path or http(s) URL (required)")
 	rootCmd.MarkFlagRequired("input")
 
 	// Optional flags
@@ -107,11 +223,84 @@ func init() {
 	rootCmd.Flags().StringVarP(&color, "color", "c", "white", "text color: 'white' or 'black' (optional)")
 	rootCmd.Flags().BoolVar(&gopher, "gopher", false, "embed gopher image instead of text (optional)")
 	rootCmd.Flags().BoolVarP(&concentrationLines, "concentration-lines", "l", false, "add concentration lines to the image (optional)")
+	rootCmd.Flags().StringVar(&fontPath, "font", "", "TrueType/OpenType font file for the text (optional, default: embedded Noto Sans Mono Bold)")
+	rootCmd.Flags().Float64Var(&textSize, "size", 0, "font size of the main text in pixels (optional, default: fit to the image)")
+	rootCmd.Flags().Float64Var(&subTextSize, "sub-size", 0, "font size of the sub-text in pixels (optional, default: fit to the image, never larger than the main text)")
+	rootCmd.Flags().Float64Var(&subTextRatio, "sub-ratio", 0, "font size of the sub-text relative to the main text, e.g. 0.4 (optional, ignored when --sub-size is given)")
+	rootCmd.Flags().StringVar(&textFill, "fill", "", "fill the text with a color, gradient or image pattern instead of --color, e.g. 'linear:#ff0000,#0000ff', 'vertical:#eee,#888', 'radial:#ff0,#f80' or 'pattern:texture.png' (optional)")
+	rootCmd.Flags().Float64Var(&textRotation, "rotate", 0, "rotate the text clockwise by this many degrees, e.g. -15 (optional)")
+	rootCmd.Flags().Float64Var(&textArc, "arc", 0, "bend the text along an arc spanning this many degrees; positive curves up, negative curves down, 360 makes a circle (optional)")
+	rootCmd.Flags().StringVar(&emojiPath, "emoji", "", "draw emoji in color from a directory of PNGs named by code point (e.g. Twemoji's 1f389.png) or a CBDT/sbix color emoji font such as NotoColorEmoji.ttf (optional)")
+	rootCmd.Flags().StringVar(&writingMode, "writing-mode", "horizontal", "writing mode of the text: 'horizontal', 'vertical' (top to bottom, sub-text to the left) or 'auto' (vertical for Japanese text on portrait images) (optional)")
+	rootCmd.Flags().StringVar(&effect, "effect", "", "draw a manga effect under the text: 'concentration' (same as -l), 'speed' (parallel speed lines), 'beta' (beta flash), 'screentone' (halftone dots) or 'burst' (jagged impact balloon) (optional)")
+	rootCmd.Flags().Float64Var(&effectAngle, "effect-angle", 0, "angle of the speed lines in degrees clockwise from horizontal, e.g. -20 for diagonal lines (optional)")
+	rootCmd.Flags().StringVar(&focus, "focus", "center", "where the concentration lines and other effects are centred: 'center', 'auto' (the detected subject, printed to stderr) or 'x,y' in pixels inside the image (optional)")
+	rootCmd.Flags().StringVar(&placement, "placement", "default", "where to put the text: 'default' (upper and lower parts of the image) or 'smart' (move the text away from faces, edges and other detailed areas) (optional)")
+	rootCmd.Flags().StringVar(&backgroundStyle, "background", "", "draw a semi-transparent background behind the text: 'box', 'band' or 'scrim' (optional)")
+	rootCmd.Flags().StringVar(&backgroundColor, "background-color", "black", "background color: 'white', 'black' or #rrggbb (optional)")
+	rootCmd.Flags().Float64Var(&backgroundOpacity, "background-opacity", 0.5, "background opacity, greater than 0 and at most 1 (optional)")
+	rootCmd.Flags().StringVar(&configPath, "config", "", "config file path (optional, default: ~/.config/lgtm/config.yaml)")
+	rootCmd.Flags().StringVar(&presetName, "preset", "", "named preset from the config file (optional)")
+	rootCmd.Flags().StringVar(&printFormat, "print", "", "print a snippet for the output after writing it: 'markdown', 'html', 'path' or 'json' (optional)")
+	rootCmd.Flags().BoolVar(&saveToLibrary, "save", false, "also add the output to the local library (optional)")
+	rootCmd.Flags().StringSliceVar(&libraryTags, "tag", nil, "tags for the library entry (requires --save) (optional)")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 0, "abort rendering after this duration, e.g. '30s' (optional, default: no timeout)")
+}
+
+// validateSizes はフォントサイズと比率のフラグが0以上の有限の数であることを検査する
+func validateSizes() error {
+	sizes := []struct {
+		flag  string
+		value float64
+	}{
+		{"size", textSize}, {"sub-size", subTextSize}, {"sub-ratio", subTextRatio},
+	}
+	for _, s := range sizes {
+		if s.value < 0 || math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			return fmt.Errorf("invalid --%s %v: must be a non-negative number", s.flag, s.value)
+		}
+	}
+	return nil
+}
+
+// validateBackground はテキストの背景のフラグを検査する
+func validateBackground() error {
+	if backgroundStyle != "" && !slices.Contains(lgtm.BackgroundStyles, lgtm.BackgroundStyle(backgroundStyle)) {
+		return fmt.Errorf("invalid --background %q: must be 'box', 'band' or 'scrim'", backgroundStyle)
+	}
+	if _, err := lgtm.ParseColor(backgroundColor); err != nil {
+		return fmt.Errorf("invalid --background-color: %w", err)
+	}
+	if !(backgroundOpacity > 0 && backgroundOpacity <= 1) {
+		return fmt.Errorf("invalid --background-opacity %v: must be greater than 0 and at most 1", backgroundOpacity)
+	}
+	return nil
+}
+
+// validateEffect は--effectの値と、-l・--focus・--effect-angleとの組み合わせを検証する
+func validateEffect() error {
+	if effect != "" && !slices.Contains(lgtm.Effects, lgtm.Effect(effect)) {
+		return fmt.Errorf("invalid --effect %q: must be 'concentration', 'speed', 'beta', 'screentone' or 'burst'", effect)
+	}
+	if concentrationLines && effect != "" && lgtm.Effect(effect) != lgtm.EffectConcentration {
+		return fmt.Errorf("--concentration-lines cannot be combined with --effect %q", effect)
+	}
+	// 効果に使われないフラグは黙って無視せずにエラーにする
+	e := renderOptions{ConcentrationLines: concentrationLines, Effect: effect}.effect()
+	switch {
+	case focus != "center" && e == "":
+		return fmt.Errorf("--focus requires --concentration-lines or --effect")
+	case focus != "center" && e == lgtm.EffectSpeedLines:
+		return fmt.Errorf("--focus cannot be combined with --effect speed")
+	case effectAngle != 0 && e != lgtm.EffectSpeedLines:
+		return fmt.Errorf("--effect-angle requires --effect speed")
+	}
+	return nil
 }
 
 func main() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
 	}
 }
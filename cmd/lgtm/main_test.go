@@ -2,15 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tMinamiii/lgtm"
 )
 
 func TestRootCmd_Help(t *testing.T) {
@@ -371,7 +381,7 @@ func TestMain_ActualCommand(t *testing.T) {
 		assert.NotNil(t, rootCmd)
 		assert.Equal(t, "lgtm [flags]", rootCmd.Use)
 		assert.Contains(t, rootCmd.Long, "LGTM is a CLI tool")
-		assert.NotNil(t, rootCmd.Run)
+		assert.NotNil(t, rootCmd.RunE)
 	})
 }
 
@@ -410,6 +420,10 @@ func TestMain_Function(t *testing.T) {
 	gopherFlag := rootCmd.Flags().Lookup("gopher")
 	assert.NotNil(t, gopherFlag)
 	assert.Equal(t, "false", gopherFlag.DefValue)
+
+	timeoutFlag := rootCmd.Flags().Lookup("timeout")
+	assert.NotNil(t, timeoutFlag)
+	assert.Equal(t, "0s", timeoutFlag.DefValue)
 }
 
 // TestRootCmd_RunLogic tests the actual Run function logic
@@ -651,3 +665,495 @@ func TestRootCmd_ActualExecution(t *testing.T) {
 		})
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	tmpDir := t.TempDir()
+	notImage := filepath.Join(tmpDir, "not_image.jpg")
+	require.NoError(t, os.WriteFile(notImage, []byte("not an image"), 0644))
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{
+			name: "missing required input flag",
+			args: []string{},
+			want: exitUsage,
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-i", "testdata/lunch.jpg", "--unknown"},
+			want: exitUsage,
+		},
+		{
+			name: "nonexistent input file",
+			args: []string{"-i", filepath.Join(tmpDir, "nonexistent.jpg")},
+			want: exitUsage,
+		},
+		{
+			name: "unsupported input format",
+			args: []string{"-i", notImage},
+			want: exitUsage,
+		},
+		{
+			name: "tag without save",
+			args: []string{"-i", "testdata/lunch.jpg", "--tag", "cats"},
+			want: exitUsage,
+		},
+		{
+			name: "missing output directory",
+			args: []string{"-i", "testdata/lunch.jpg", "-o", filepath.Join(tmpDir, "missing", "out.jpg")},
+			want: exitUsage,
+		},
+		{
+			name: "timeout",
+			args: []string{"-i", "testdata/lunch.jpg", "-o", filepath.Join(tmpDir, "timeout.jpg"), "--timeout", "1ns"},
+			want: exitInternal,
+		},
+		{
+			name: "success",
+			args: []string{"-i", "testdata/lunch.jpg", "-o", filepath.Join(tmpDir, "out.jpg"), "--timeout", "0"},
+			want: exitOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRootFlags()
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			defer rootCmd.SetArgs(nil)
+
+			err := rootCmd.Execute()
+			assert.Equal(t, tt.want, exitCode(err), "error: %v", err)
+		})
+	}
+
+	resetRootFlags()
+}
+
+func TestNewExitError(t *testing.T) {
+	writeError := func(err error) error {
+		return &lgtm.Error{Path: "out.jpg", Stage: lgtm.StageWrite, Kind: lgtm.ErrOutputWrite, Err: err}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "missing output directory", err: writeError(&fs.PathError{Op: "open", Path: "missing/out.jpg", Err: fs.ErrNotExist}), want: exitUsage},
+		{name: "unwritable output directory", err: writeError(&fs.PathError{Op: "open", Path: "/out.jpg", Err: fs.ErrPermission}), want: exitUsage},
+		{name: "disk full", err: writeError(&fs.PathError{Op: "write", Path: "out.jpg", Err: syscall.ENOSPC}), want: exitInternal},
+		{name: "missing input", err: &fs.PathError{Op: "open", Path: "in.jpg", Err: fs.ErrNotExist}, want: exitUsage},
+		{name: "text overflow", err: &lgtm.Error{Path: "in.jpg", Stage: lgtm.StageLayout, Kind: lgtm.ErrTextOverflow}, want: exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, exitCode(newExitError(tt.err)))
+		})
+	}
+}
+
+func TestRootCmd_InputURL(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name     string
+		url      string
+		wantCode int
+	}{
+		{
+			name:     "download and render",
+			url:      srv.URL + "/lunch.jpg",
+			wantCode: exitOK,
+		},
+		{
+			name:     "not found",
+			url:      srv.URL + "/missing.jpg",
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reset global variables
+			color = "white"
+			gopher = false
+			concentrationLines = false
+			inputPath = ""
+			outputPath = ""
+			customText = ""
+			customSubText = ""
+			timeout = 0
+
+			output := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "_")+".jpg")
+			rootCmd.SetArgs([]string{"-i", tt.url, "-o", output})
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			defer rootCmd.SetArgs(nil)
+
+			err := rootCmd.Execute()
+			assert.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode == exitOK {
+				assert.FileExists(t, output)
+			}
+		})
+	}
+}
+
+func TestRootCmd_Print(t *testing.T) {
+	tmpDir := t.TempDir()
+	output := filepath.Join(tmpDir, "out.jpg")
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantCode int
+	}{
+		{
+			name: "path",
+			args: []string{"--print", "path"},
+			want: output + "\n",
+		},
+		{
+			name: "markdown",
+			args: []string{"--print", "markdown", "-t", "SHIP [IT]", "-s", "Nice"},
+			want: "![SHIP \\[IT\\] - Nice](" + output + ")\n",
+		},
+		{
+			name: "markdown gopher",
+			args: []string{"--print", "markdown", "--gopher"},
+			want: "![LGTM](" + output + ")\n",
+		},
+		{
+			name: "html",
+			args: []string{"--print", "html", "-t", `"Hi"`},
+			want: `<img src="` + output + `" alt="&#34;Hi&#34; - Looks Good To Me" width="4032" height="3024">` + "\n",
+		},
+		{
+			name:     "invalid format",
+			args:     []string{"--print", "xml"},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reset global variables
+			color = "white"
+			gopher = false
+			concentrationLines = false
+			inputPath = ""
+			outputPath = ""
+			customText = ""
+			customSubText = ""
+			timeout = 0
+			printFormat = ""
+
+			var buf bytes.Buffer
+			rootCmd.SetArgs(append([]string{"-i", "testdata/lunch.jpg", "-o", output}, tt.args...))
+			rootCmd.SetOut(&buf)
+			rootCmd.SetErr(io.Discard)
+			defer rootCmd.SetArgs(nil)
+
+			err := rootCmd.Execute()
+			assert.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode == exitOK {
+				assert.Equal(t, tt.want, buf.String())
+			}
+		})
+	}
+}
+
+// rootResult はルートコマンドを1回実行した結果
+type rootResult struct {
+	output string // 出力画像のパス
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+}
+
+// runRoot はフラグを初期値に戻してから、testdata/lunch.jpgを一時ディレクトリに描画するルートコマンドを実行する
+// フラグと出力先はテストの終了時に元に戻す
+func runRoot(t *testing.T, args ...string) (*rootResult, error) {
+	t.Helper()
+	resetRootFlags()
+	t.Cleanup(func() {
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		resetRootFlags()
+	})
+
+	r := &rootResult{output: filepath.Join(t.TempDir(), "out.jpg")}
+	rootCmd.SetArgs(append([]string{"-i", "testdata/lunch.jpg", "-o", r.output}, args...))
+	rootCmd.SetOut(&r.stdout)
+	rootCmd.SetErr(&r.stderr)
+	return r, rootCmd.Execute()
+}
+
+var plain struct {
+	once sync.Once
+	data []byte
+}
+
+// changedFromPlain は出力画像がフラグを指定せずに描画した画像と異なるかどうかを返す
+func changedFromPlain(t *testing.T, output string) bool {
+	t.Helper()
+	got, err := os.ReadFile(output)
+	require.NoError(t, err)
+
+	plain.once.Do(func() {
+		r, err := runRoot(t)
+		require.NoError(t, err)
+		plain.data, err = os.ReadFile(r.output)
+		require.NoError(t, err)
+	})
+	require.NotEmpty(t, plain.data)
+	return !bytes.Equal(got, plain.data)
+}
+
+// rootCase はルートコマンドのフラグの組み合わせと期待する結果
+type rootCase struct {
+	name      string
+	args      []string
+	wantCode  int
+	unchanged bool // フラグなしと同じ画像になる
+}
+
+// runRootCases は各ケースを実行し、終了コードと、成功した場合は出力画像がフラグで変わったかを検査する
+func runRootCases(t *testing.T, tests []rootCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := runRoot(t, tt.args...)
+			require.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode == exitOK {
+				assert.Equal(t, !tt.unchanged, changedFromPlain(t, r.output))
+			}
+		})
+	}
+}
+
+func TestRootCmd_Sizes(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "fixed sizes", args: []string{"--size", "200", "--sub-size", "60"}},
+		{name: "sub ratio", args: []string{"--size", "200", "--sub-ratio", "0.3"}},
+		{name: "negative size", args: []string{"--size", "-1"}, wantCode: exitUsage},
+		{name: "negative sub ratio", args: []string{"--sub-ratio", "-0.5"}, wantCode: exitUsage},
+		{name: "not a number", args: []string{"--sub-size", "big"}, wantCode: exitUsage},
+	})
+}
+
+func TestRenderOptions_Layout(t *testing.T) {
+	// --size はピクセルで指定し、描画される文字の高さに反映される
+	opts := renderOptions{Size: 100, SubSize: 40, SubRatio: 0.3}
+	layout := opts.layout(nil)
+	assert.Equal(t, 0.3, layout.SubRatio)
+
+	main := lgtm.NewMainText("LGTM", lgtm.TextColorWhite)
+	sub := lgtm.NewSubText("LGTM", lgtm.TextColorWhite)
+	r, err := lgtm.Layout(image.Rect(0, 0, 2000, 2000), main, sub, layout)
+	require.NoError(t, err)
+
+	// NotoSansMonoの大文字の高さはemの0.714倍（Gの丸みのはみ出しを許容する）
+	assert.InDelta(t, 100*0.714, float64(r.Main.Bounds.Dy()), 4)
+	assert.InDelta(t, 40*0.714, float64(r.Sub.Bounds.Dy()), 2)
+}
+
+func TestRootCmd_Background(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "box", args: []string{"--background", "box"}},
+		{name: "scrim with color", args: []string{"--background", "scrim", "--background-color", "#ffffff", "--background-opacity", "0.8"}},
+		{name: "unknown style", args: []string{"--background", "circle"}, wantCode: exitUsage},
+		{name: "invalid color", args: []string{"--background", "band", "--background-color", "red"}, wantCode: exitUsage},
+		{name: "opacity out of range", args: []string{"--background", "band", "--background-opacity", "2"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_Fill(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "linear", args: []string{"--fill", "linear:#ff0000,#0000ff"}},
+		{name: "pattern", args: []string{"--fill", "pattern:testdata/lunch.jpg"}},
+		{name: "unknown type", args: []string{"--fill", "conic:#fff,#000"}, wantCode: exitUsage},
+		{name: "one gradient color", args: []string{"--fill", "radial:#fff"}, wantCode: exitUsage},
+		{name: "missing pattern", args: []string{"--fill", "pattern:testdata/missing.png"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_RotateArc(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "rotate", args: []string{"--rotate", "-15"}},
+		{name: "arc", args: []string{"--arc", "120"}},
+		{name: "rotated circle", args: []string{"--rotate", "90", "--arc", "-360"}},
+		{name: "arc out of range", args: []string{"--arc", "400"}, wantCode: exitUsage},
+		{name: "rotate not a number", args: []string{"--rotate", "left"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_WritingMode(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "vertical", args: []string{"--writing-mode", "vertical", "-t", "最高です"}},
+		// 横長の画像では横書きになる
+		{name: "auto", args: []string{"--writing-mode", "auto"}, unchanged: true},
+		{name: "horizontal", args: []string{"--writing-mode", "horizontal"}, unchanged: true},
+		{name: "unknown", args: []string{"--writing-mode", "diagonal"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_Emoji(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "png directory", args: []string{"--emoji", "../../testdata/emoji", "-t", "LGTM 🎉"}},
+		{name: "sbix font", args: []string{"--emoji", "../../testdata/sbix-emoji.ttf", "-t", "LGTM 🎉"}},
+		{name: "missing", args: []string{"--emoji", "testdata/missing"}, wantCode: exitUsage},
+		{name: "not a font", args: []string{"--emoji", "testdata/lunch.jpg"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_Placement(t *testing.T) {
+	runRootCases(t, []rootCase{
+		{name: "smart", args: []string{"--placement", "smart"}},
+		{name: "smart with concentration lines", args: []string{"--placement", "smart", "-l"}},
+		{name: "default", args: []string{"--placement", "default"}, unchanged: true},
+		{name: "unknown", args: []string{"--placement", "center"}, wantCode: exitUsage},
+		{name: "smart with gopher", args: []string{"--placement", "smart", "--gopher"}, wantCode: exitUsage},
+	})
+}
+
+func TestRootCmd_Focus(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+		wantFocus  any
+	}{
+		{name: "auto", args: []string{"-l", "--focus", "auto"}, wantStderr: "concentration lines focus: "},
+		{name: "point", args: []string{"-l", "--focus", "120, 80"}, wantFocus: map[string]any{"x": float64(120), "y": float64(80)}},
+		{name: "center", args: []string{"-l", "--focus", "center"}},
+		{name: "without concentration lines", args: []string{"--focus", "auto"}, wantCode: exitUsage},
+		{name: "unknown", args: []string{"-l", "--focus", "left"}, wantCode: exitUsage},
+		{name: "negative", args: []string{"-l", "--focus", "-1,2"}, wantCode: exitUsage},
+		{name: "outside the image", args: []string{"-l", "--focus", "99999,99999"}, wantCode: exitUsage},
+		{name: "bottom right corner", args: []string{"-l", "--focus", "4032,3024"}, wantFocus: map[string]any{"x": float64(4032), "y": float64(3024)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := runRoot(t, append([]string{"--print", "json"}, tt.args...)...)
+			require.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode != exitOK {
+				return
+			}
+			assert.FileExists(t, r.output)
+			if tt.wantStderr == "" {
+				assert.Empty(t, r.stderr.String())
+			} else {
+				assert.Contains(t, r.stderr.String(), tt.wantStderr)
+			}
+
+			// 推定した点も--focusで指定した点もJSONに出力する
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(r.stdout.Bytes(), &got))
+			switch {
+			case tt.wantFocus != nil:
+				assert.Equal(t, tt.wantFocus, got["focus"])
+			case tt.wantStderr != "":
+				focus, ok := got["focus"].(map[string]any)
+				require.True(t, ok, "focus is missing from %v", got)
+				assert.Contains(t, r.stderr.String(), fmt.Sprintf("focus: %v,%v ", focus["x"], focus["y"]))
+			default:
+				assert.NotContains(t, got, "focus")
+			}
+		})
+	}
+}
+
+func TestRootCmd_Effect(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStderr string
+		wantFocus  bool
+	}{
+		{name: "concentration", args: []string{"--effect", "concentration", "--focus", "10,20"}, wantFocus: true},
+		{name: "same as concentration lines", args: []string{"-l", "--effect", "concentration"}},
+		{name: "speed", args: []string{"--effect", "speed", "--effect-angle", "-20"}},
+		{name: "speed with focus", args: []string{"--effect", "speed", "--focus", "auto"}, wantCode: exitUsage},
+		{name: "angle without effect", args: []string{"--effect-angle", "30"}, wantCode: exitUsage},
+		{name: "angle with beta", args: []string{"--effect", "beta", "--effect-angle", "30"}, wantCode: exitUsage},
+		{name: "beta", args: []string{"--effect", "beta", "--focus", "10,20"}, wantFocus: true},
+		{name: "screentone", args: []string{"--effect", "screentone"}},
+		{name: "burst", args: []string{"--effect", "burst", "--focus", "auto"}, wantStderr: "burst effect focus: ", wantFocus: true},
+		{name: "unknown", args: []string{"--effect", "sparkle"}, wantCode: exitUsage},
+		{name: "with concentration lines", args: []string{"-l", "--effect", "speed"}, wantCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := runRoot(t, append([]string{"--print", "json"}, tt.args...)...)
+			require.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.wantCode != exitOK {
+				return
+			}
+			assert.True(t, changedFromPlain(t, r.output))
+			if tt.wantStderr == "" {
+				assert.Empty(t, r.stderr.String())
+			} else {
+				assert.Contains(t, r.stderr.String(), tt.wantStderr)
+			}
+
+			// 中心を持つ効果だけ中心をJSONに出力する
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(r.stdout.Bytes(), &got))
+			if tt.wantFocus {
+				assert.Contains(t, got, "focus")
+			} else {
+				assert.NotContains(t, got, "focus")
+			}
+		})
+	}
+}
+
+func TestPrintSnippet_JSON(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "out.jpg")
+	opts := renderOptions{InputPath: "testdata/lunch.jpg", OutputPath: output}
+	path, err := render(context.Background(), opts)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, printSnippet(&buf, "json", path, opts))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	info, err := os.Stat(output)
+	require.NoError(t, err)
+	assert.Equal(t, output, got["path"])
+	assert.Equal(t, "LGTM - Looks Good To Me", got["alt"])
+	assert.Equal(t, "jpeg", got["format"])
+	assert.Equal(t, float64(1), got["frames"])
+	assert.Equal(t, float64(info.Size()), got["bytes"])
+	assert.NotZero(t, got["width"])
+	assert.NotZero(t, got["height"])
+}
+
+func TestRender_DefaultOutputPath(t *testing.T) {
+	// 出力パスを省略するとカレントディレクトリに出力される
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	input, err := filepath.Abs("testdata/lunch.jpg")
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer os.Chdir(wd)
+
+	path, err := render(context.Background(), renderOptions{InputPath: input, Gopher: true})
+	require.NoError(t, err)
+	assert.Equal(t, "lunch-gopher.jpeg", path)
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/tMinamiii/lgtm"
+)
+
+// printFormats は--printで指定できる出力形式
+var printFormats = []string{"markdown", "html", "path", "json"}
+
+// snippet は描画結果をプルリクエストのレビューに貼り付けるための情報
+type snippet struct {
+	Path  string      `json:"path"`
+	Alt   string      `json:"alt"`
+	Focus *focusPoint `json:"focus,omitempty"` // 集中線などの効果の中心（画像の中心の場合は省略）
+	*lgtm.ImageInfo
+}
+
+// focusPoint は効果の中心のピクセル座標
+type focusPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func validatePrintFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range printFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid --print %q: must be one of %s", format, strings.Join(printFormats, ", "))
+}
+
+// altText はメインテキストとサブテキストから画像の代替テキストを作る
+func altText(opts renderOptions) string {
+	if opts.Gopher {
+		return lgtm.DefaultMainText
+	}
+	mainText := lgtm.DefaultMainText
+	if opts.Text != "" {
+		mainText = opts.Text
+	}
+	subText := lgtm.DefaultSubText
+	if opts.SubText != "" {
+		subText = opts.SubText
+	}
+	return mainText + " - " + subText
+}
+
+// printSnippet は出力した画像をformatの形式でwに書き込む
+func printSnippet(w io.Writer, format, path string, opts renderOptions) error {
+	if format == "" {
+		return nil
+	}
+
+	alt := altText(opts)
+	switch format {
+	case "path":
+		_, err := fmt.Fprintln(w, path)
+		return err
+
+	case "markdown":
+		_, err := fmt.Fprintf(w, "![%s](%s)\n", markdownEscaper.Replace(alt), markdownURL(path))
+		return err
+	}
+
+	info, err := lgtm.Describe(path)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "html":
+		_, err = fmt.Fprintf(w, "<img src=\"%s\" alt=\"%s\" width=\"%d\" height=\"%d\">\n",
+			html.EscapeString(path), html.EscapeString(alt), info.Width, info.Height)
+		return err
+
+	default:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		s := &snippet{Path: path, Alt: alt, ImageInfo: info}
+		if p, err := parseFocus(opts.Focus); err == nil && p != nil && opts.focused() {
+			s.Focus = &focusPoint{X: p.X, Y: p.Y}
+		}
+		return enc.Encode(s)
+	}
+}
+
+// markdownEscaper は代替テキスト中のMarkdownの記号をエスケープする
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+
+// markdownURL は空白や括弧を含むパスを<>で囲む
+func markdownURL(path string) string {
+	if strings.ContainsAny(path, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(path) + ">"
+	}
+	return path
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tMinamiii/lgtm"
+)
+
+// renderOptions はCLIとサーバーで共通の描画設定
+type renderOptions struct {
+	InputPath          string
+	OutputPath         string
+	Text               string
+	SubText            string
+	Color              string
+	Gopher             bool
+	ConcentrationLines bool
+	FontPath           string
+	Size               float64 // メインテキストのフォントサイズ（ピクセル。0なら画像に合わせる）
+	SubSize            float64 // サブテキストのフォントサイズ（ピクセル。0ならSubRatioまたは画像に合わせる）
+	SubRatio           float64 // メインテキストに対するサブテキストの大きさの比率
+	Background         string  // テキストの背景の形（空なら背景なし）
+	BackgroundColor    string  // 背景の色（空なら黒）
+	BackgroundOpacity  float64 // 背景の不透明度（0なら0.5）
+	Fill               string  // テキストの塗り（"linear:#ff0000,#0000ff" など。空ならColorで塗る）
+	Rotation           float64 // テキストの時計回りの回転角（度）
+	Arc                float64 // テキストを沿わせる円弧の中心角（度）
+	WritingMode        string  // 書字方向（"vertical" か "auto"。空か "horizontal" なら横書き）
+	Emoji              string  // 絵文字のPNG画像のディレクトリかカラー絵文字フォントのパス（空なら絵文字もフォントで描く）
+	Placement          string  // テキストの配置（"smart" なら画像の重要度の低い範囲に置く）
+	Focus              string  // 集中線などの効果の中心（"x,y" のピクセル座標。空か "center" なら画像の中心）
+	Effect             string  // 画像に重ねる効果（空でConcentrationLinesがtrueなら集中線）
+	EffectAngle        float64 // 流線の向き（度）
+}
+
+// effect は描画する効果を返す。効果を描かない場合は空文字列を返す
+func (o renderOptions) effect() lgtm.Effect {
+	if o.Effect != "" {
+		return lgtm.Effect(o.Effect)
+	}
+	if o.ConcentrationLines {
+		return lgtm.EffectConcentration
+	}
+	return ""
+}
+
+// fontDPI はlgtmパッケージがフォントサイズのポイントをピクセルに換算する解像度
+const fontDPI = 96
+
+// layout はピクセルで指定されたフォントサイズをポイントに換算してレイアウトの調整項目を作る
+func (o renderOptions) layout(saliency *lgtm.SaliencyMap) lgtm.LayoutOptions {
+	return lgtm.LayoutOptions{
+		Size:     o.Size * 72 / fontDPI,
+		SubSize:  o.SubSize * 72 / fontDPI,
+		SubRatio: o.SubRatio,
+		Saliency: saliency,
+	}
+}
+
+// focused は中心を持つ効果を描くかどうかを返す
+func (o renderOptions) focused() bool {
+	effect := o.effect()
+	return effect != "" && effect != lgtm.EffectSpeedLines
+}
+
+// background は描画設定からテキストの背景を作る
+func (o renderOptions) background() (*lgtm.Background, error) {
+	if o.Background == "" {
+		return nil, nil
+	}
+	bg := &lgtm.Background{Style: lgtm.BackgroundStyle(o.Background), Opacity: o.BackgroundOpacity}
+	if o.BackgroundColor != "" {
+		c, err := lgtm.ParseColor(o.BackgroundColor)
+		if err != nil {
+			return nil, err
+		}
+		bg.Color = c
+	}
+	return bg, nil
+}
+
+// parseFocus は "x,y" のピクセル座標を効果の中心にする。空文字列と "center" はnil（画像の中心）を返す
+func parseFocus(s string) (*lgtm.Point, error) {
+	if s == "" || s == "center" {
+		return nil, nil
+	}
+	x, y, ok := strings.Cut(s, ",")
+	if ok {
+		px, errX := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		py, errY := strconv.ParseFloat(strings.TrimSpace(y), 64)
+		if errX == nil && errY == nil && px >= 0 && py >= 0 && !math.IsInf(px, 0) && !math.IsInf(py, 0) {
+			return &lgtm.Point{X: px, Y: py}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid --focus %q: must be 'center', 'auto' or 'x,y' in pixels", s)
+}
+
+// formatFocus は効果の中心を--focusに指定できる形式にする
+func formatFocus(p lgtm.Point) string {
+	return fmt.Sprintf("%.0f,%.0f", p.X, p.Y)
+}
+
+// render は効果・Gopher・テキストの各Drawerを順に適用して画像を出力し、出力先のパスを返す
+func render(ctx context.Context, opts renderOptions) (string, error) {
+	currentInput := opts.InputPath
+	tempOutput := ""
+
+	// フォントは描画を始める前に読み込み、ファイルの誤りを早めに報告する
+	font := lgtm.NotoSansMono
+	if opts.FontPath != "" && !opts.Gopher {
+		data, err := os.ReadFile(opts.FontPath)
+		if err != nil {
+			return "", &lgtm.Error{Path: opts.FontPath, Stage: lgtm.StageLayout, Kind: lgtm.ErrFontLoad, Err: err}
+		}
+		font = lgtm.Font(data)
+	}
+
+	// 出力パスが指定されていない場合は入力画像のフォーマットから出力先を決める
+	output := opts.OutputPath
+	if output == "" {
+		info, err := lgtm.Describe(opts.InputPath)
+		if err != nil {
+			return "", err
+		}
+		suffix := "lgtm"
+		if opts.Gopher {
+			suffix = "gopher"
+		}
+		output = lgtm.DefaultOutputPath(opts.InputPath, suffix, info.Format)
+	}
+
+	// テキスト色を決定
+	textColor := lgtm.TextColorWhite
+	if opts.Color == "black" {
+		textColor = lgtm.TextColorBlack
+	}
+
+	// 重要度は集中線などの効果を描く前の元の画像から計算する
+	var saliency *lgtm.SaliencyMap
+	if opts.Placement == "smart" && !opts.Gopher {
+		var err error
+		if saliency, err = lgtm.LoadSaliency(opts.InputPath); err != nil {
+			return "", err
+		}
+	}
+
+	// 集中線などの効果を先に描画（指定されている場合）
+	if effect := opts.effect(); effect != "" {
+		if opts.OutputPath == "" {
+			tempOutput = opts.InputPath + ".tmp.jpg"
+		} else {
+			tempOutput = output + ".tmp.jpg"
+		}
+		// 流線は中心を持たないため--focusを使わない
+		var point *lgtm.Point
+		if opts.focused() {
+			p, err := parseFocus(opts.Focus)
+			if err != nil {
+				return "", err
+			}
+			point = p
+		}
+		// 線の色をテキスト色と同じに設定
+		d, err := lgtm.NewEffectDrawer(effect, currentInput, tempOutput, lgtm.EffectOptions{Color: textColor.Gray16(), Focus: point, Angle: opts.EffectAngle})
+		if err != nil {
+			return "", err
+		}
+		if err := d.DrawContext(ctx); err != nil {
+			return "", err
+		}
+		// 一時ファイルを削除
+		defer os.Remove(tempOutput)
+		currentInput = tempOutput
+	}
+
+	// Gopherモードの場合
+	if opts.Gopher {
+		d := lgtm.NewGopherDrawer(currentInput, output)
+		return output, lgtm.DrawContext(ctx, d)
+	}
+
+	// テキストを描画（デフォルト動作または集中線の後に描画）
+	mainText := lgtm.DefaultMainText
+	subText := lgtm.DefaultSubText
+
+	if opts.Text != "" {
+		mainText = opts.Text
+	}
+
+	if opts.SubText != "" {
+		subText = opts.SubText
+	}
+
+	background, err := opts.background()
+	if err != nil {
+		return "", err
+	}
+
+	var fill *lgtm.Fill
+	if opts.Fill != "" {
+		if fill, err = lgtm.ParseFill(opts.Fill); err != nil {
+			return "", err
+		}
+	}
+	var emoji lgtm.EmojiSource
+	if opts.Emoji != "" {
+		if emoji, err = lgtm.LoadEmoji(opts.Emoji); err != nil {
+			return "", err
+		}
+	}
+
+	main := lgtm.NewMainText(mainText, textColor)
+	sub := lgtm.NewSubText(subText, textColor)
+	main.Font = font
+	sub.Font = font
+	main.Background = background
+	sub.Background = background
+	main.Fill = fill
+	sub.Fill = fill
+	main.Rotation, main.Arc = opts.Rotation, opts.Arc
+	sub.Rotation, sub.Arc = opts.Rotation, opts.Arc
+	main.Emoji, sub.Emoji = emoji, emoji
+	if opts.WritingMode != "horizontal" {
+		main.WritingMode = lgtm.WritingMode(opts.WritingMode)
+		sub.WritingMode = lgtm.WritingMode(opts.WritingMode)
+	}
+
+	d := lgtm.NewTextDrawer(main, sub, currentInput, output)
+	if drawer, ok := d.(*lgtm.TextDrawer); ok {
+		drawer.Layout = opts.layout(saliency)
+	}
+	return output, lgtm.DrawContext(ctx, d)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tMinamiii/lgtm"
+)
+
+var (
+	serveAddr      string
+	serveMaxUpload int64
+	serveTimeout   time.Duration
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags]",
+	Short: "Run an HTTP server that renders LGTM images",
+	Long: `Run an HTTP server that renders LGTM images with the same drawers as the CLI.
+
+Endpoints:
+  GET  /healthz  returns 200 while the server is running
+  POST /render   renders the uploaded image and returns it
+
+POST /render accepts the image either as the raw request body or as the "image"
+field of a multipart/form-data request. Options are given as query parameters
+(text, sub_text, color, mode, concentration_lines) or as a JSON object in the
+"options" multipart field, e.g. {"text": "SHIP IT", "color": "black", "mode": "text"}.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		srv := &http.Server{
+			Addr:              serveAddr,
+			Handler:           newServer(serveMaxUpload, serveTimeout),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		return listenAndServe(ctx, srv, cmd.ErrOrStderr())
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "address to listen on")
+	serveCmd.Flags().Int64Var(&serveMaxUpload, "max-upload", 10<<20, "maximum request body size in bytes")
+	serveCmd.Flags().DurationVar(&serveTimeout, "timeout", 30*time.Second, "maximum rendering time per request (0 means no timeout)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// listenAndServe はctxがキャンセルされるまでサーバーを動かし、処理中のリクエストを待ってから終了する
+func listenAndServe(ctx context.Context, srv *http.Server, w io.Writer) error {
+	errCh := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(w, "listening on %s\n", srv.Addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// renderRequest はPOST /renderで指定できる描画設定
+type renderRequest struct {
+	Text               string `json:"text"`
+	SubText            string `json:"sub_text"`
+	Color              string `json:"color"`
+	Mode               string `json:"mode"`
+	ConcentrationLines bool   `json:"concentration_lines"`
+}
+
+func (r *renderRequest) validate() error {
+	switch r.Color {
+	case "", "white", "black":
+	default:
+		return fmt.Errorf("invalid color %q: must be 'white' or 'black'", r.Color)
+	}
+	switch r.Mode {
+	case "", "text", "gopher":
+	default:
+		return fmt.Errorf("invalid mode %q: must be 'text' or 'gopher'", r.Mode)
+	}
+	return nil
+}
+
+// formatExtensions は受け付ける画像のContent-Typeと出力ファイルの拡張子
+var formatExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+type server struct {
+	maxUpload int64
+	timeout   time.Duration
+}
+
+func newServer(maxUpload int64, timeout time.Duration) http.Handler {
+	s := &server{maxUpload: maxUpload, timeout: timeout}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("POST /render", s.handleRender)
+	return mux
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *server) handleRender(w http.ResponseWriter, r *http.Request) {
+	// クライアントが切断するとr.Context()がキャンセルされ、描画も中断される
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	req, body, err := s.readRequest(r)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	contentType := http.DetectContentType(body)
+	ext, ok := formatExtensions[contentType]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported content type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "lgtm-serve-*")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	inputPath := filepath.Join(dir, "input."+ext)
+	outputPath := filepath.Join(dir, "output."+ext)
+	if err := os.WriteFile(inputPath, body, 0o600); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	_, err = render(ctx, renderOptions{
+		InputPath:          inputPath,
+		OutputPath:         outputPath,
+		Text:               req.Text,
+		SubText:            req.SubText,
+		Color:              req.Color,
+		Gopher:             req.Mode == "gopher",
+		ConcentrationLines: req.ConcentrationLines,
+	})
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	out, err := os.ReadFile(outputPath)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(out)))
+	w.Write(out)
+}
+
+// readRequest はクエリパラメータ、multipartのoptionsフィールドの順に設定を読み、画像本体を返す
+func (s *server) readRequest(r *http.Request) (*renderRequest, []byte, error) {
+	req := &renderRequest{}
+	query := r.URL.Query()
+	req.Text = query.Get("text")
+	req.SubText = query.Get("sub_text")
+	req.Color = query.Get("color")
+	req.Mode = query.Get("mode")
+	if v := query.Get("concentration_lines"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, nil, badRequest(fmt.Errorf("invalid concentration_lines %q", v))
+		}
+		req.ConcentrationLines = b
+	}
+
+	var body []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(s.maxUpload); err != nil {
+			return nil, nil, badRequest(err)
+		}
+		if options := r.FormValue("options"); options != "" {
+			if err := json.Unmarshal([]byte(options), req); err != nil {
+				return nil, nil, badRequest(fmt.Errorf("invalid options: %w", err))
+			}
+		}
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			return nil, nil, badRequest(fmt.Errorf("image: %w", err))
+		}
+		defer file.Close()
+		if body, err = io.ReadAll(file); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(body) == 0 {
+		return nil, nil, badRequest(errors.New("empty image"))
+	}
+	if err := req.validate(); err != nil {
+		return nil, nil, badRequest(err)
+	}
+	return req, body, nil
+}
+
+// requestError はクライアントの誤りによるエラー
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &requestError{err: err}
+}
+
+// writeError はエラーの種類に応じたステータスコードでレスポンスを返す
+func (s *server) writeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var reqErr *requestError
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, lgtm.ErrLimitExceeded):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, lgtm.ErrUnsupportedFormat):
+		status = http.StatusUnsupportedMediaType
+	case errors.Is(err, lgtm.ErrDecode), errors.Is(err, lgtm.ErrTextOverflow), errors.As(err, &reqErr):
+		status = http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		// クライアントが切断済みのためレスポンスは届かない
+		return
+	}
+	// クライアントの誤り以外は一時ファイルのパスなどを含むため、詳細はサーバーのログにだけ出す
+	if errors.As(err, &reqErr) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("render failed: %v", err)
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(t *testing.T, format string) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	buf := &bytes.Buffer{}
+	switch format {
+	case "png":
+		require.NoError(t, png.Encode(buf, img))
+	case "gif":
+		require.NoError(t, gif.Encode(buf, img, nil))
+	default:
+		require.NoError(t, jpeg.Encode(buf, img, nil))
+	}
+	return buf.Bytes()
+}
+
+func multipartBody(t *testing.T, img []byte, options string) (io.Reader, string) {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	if options != "" {
+		require.NoError(t, mw.WriteField("options", options))
+	}
+	fw, err := mw.CreateFormFile("image", "image")
+	require.NoError(t, err)
+	_, err = fw.Write(img)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return buf, mw.FormDataContentType()
+}
+
+func TestServer_Health(t *testing.T) {
+	srv := httptest.NewServer(newServer(1<<20, 0))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/healthz")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "ok\n", string(body))
+}
+
+func TestServer_Render(t *testing.T) {
+	srv := httptest.NewServer(newServer(1<<20, 30*time.Second))
+	defer srv.Close()
+
+	jpg := testImage(t, "jpeg")
+
+	tests := []struct {
+		name            string
+		query           string
+		body            func() (io.Reader, string)
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:  "raw jpeg body",
+			query: "?text=SHIP+IT&color=black",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(jpg), "image/jpeg"
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/jpeg",
+		},
+		{
+			name: "raw png body with concentration lines",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(testImage(t, "png")), "application/octet-stream"
+			},
+			query:           "?concentration_lines=true",
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/png",
+		},
+		{
+			name: "multipart gif with json options",
+			body: func() (io.Reader, string) {
+				return multipartBody(t, testImage(t, "gif"), `{"mode": "gopher"}`)
+			},
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/gif",
+		},
+		{
+			name: "json options override query",
+			body: func() (io.Reader, string) {
+				return multipartBody(t, jpg, `{"color": "black"}`)
+			},
+			query:           "?color=red",
+			wantStatus:      http.StatusOK,
+			wantContentType: "image/jpeg",
+		},
+		{
+			name:  "invalid color",
+			query: "?color=red",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(jpg), "image/jpeg"
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `invalid color "red": must be 'white' or 'black'` + "\n",
+		},
+		{
+			name:  "invalid mode",
+			query: "?mode=unknown",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(jpg), "image/jpeg"
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "invalid json options",
+			body: func() (io.Reader, string) {
+				return multipartBody(t, jpg, `{`)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "empty body",
+			body: func() (io.Reader, string) {
+				return strings.NewReader(""), "image/jpeg"
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unsupported content",
+			body: func() (io.Reader, string) {
+				return strings.NewReader("not an image"), "text/plain"
+			},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "truncated image",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(jpg[:len(jpg)/2]), "image/jpeg"
+			},
+			wantStatus: http.StatusBadRequest,
+			// 一時ファイルのパスを含む描画のエラーは返さない
+			wantBody: "Bad Request\n",
+		},
+		{
+			name: "too large",
+			body: func() (io.Reader, string) {
+				return bytes.NewReader(make([]byte, 2<<20)), "image/jpeg"
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := tt.body()
+			res, err := http.Post(srv.URL+"/render"+tt.query, contentType, body)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, res.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				if tt.wantBody != "" {
+					got, err := io.ReadAll(res.Body)
+					require.NoError(t, err)
+					assert.Equal(t, tt.wantBody, string(got))
+				}
+				return
+			}
+
+			assert.Equal(t, tt.wantContentType, res.Header.Get("Content-Type"))
+			img, format, err := image.Decode(res.Body)
+			require.NoError(t, err)
+			assert.Equal(t, strings.TrimPrefix(tt.wantContentType, "image/"), format)
+			assert.Equal(t, image.Rect(0, 0, 320, 240), img.Bounds())
+		})
+	}
+}
+
+func TestServer_RenderMethodNotAllowed(t *testing.T) {
+	srv := httptest.NewServer(newServer(1<<20, 0))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/render")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestServer_RenderTimeout(t *testing.T) {
+	srv := httptest.NewServer(newServer(1<<20, time.Nanosecond))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL+"/render", "image/jpeg", bytes.NewReader(testImage(t, "jpeg")))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestListenAndServe_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := &http.Server{Addr: "127.0.0.1:0", Handler: newServer(1<<20, 0)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- listenAndServe(ctx, srv, io.Discard)
+	}()
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tMinamiii/lgtm"
+)
+
+var (
+	specPath    string
+	specInput   string
+	specOutput  string
+	specTimeout time.Duration
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render --spec <file> [flags]",
+	Short: "Render an image from a JSON/YAML layer spec",
+	Long: `Render an image from a JSON or YAML spec that stacks layers on the input image.
+
+Layers are drawn bottom to top. Each layer has a type (text, sticker,
+concentration_lines, shape or filter) and positions and sizes are ratios of the
+canvas width and height. Relative paths in the spec are resolved from the spec
+file's directory; --input and --output override the spec's input and output.
+
+  input: cat.jpeg
+  layers:
+    - type: filter
+      filter: grayscale
+    - type: concentration_lines
+    - type: text
+      text: SHIP IT
+      color: "#ffcc00"
+      y: 0.8
+      size: 0.15
+    - type: sticker
+      image: gopher
+      x: 0.85
+      y: 0.85
+      width: 0.2`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		spec, err := lgtm.LoadSpec(specPath)
+		if err != nil {
+			return newExitError(err)
+		}
+		if specInput != "" {
+			spec.Input = specInput
+		}
+		if specOutput != "" {
+			spec.Output = specOutput
+		}
+		if spec.Input == "" {
+			return errors.New("no input: set 'input' in the spec or use --input")
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if specTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, specTimeout)
+			defer cancel()
+		}
+
+		// URLが指定された場合はダウンロードした一時ファイルを入力にする
+		if lgtm.IsURL(spec.Input) {
+			path, cleanup, err := lgtm.FromURL(ctx, spec.Input, lgtm.FetchOptions{})
+			if err != nil {
+				return newExitError(err)
+			}
+			defer cleanup()
+			spec.Input = path
+		}
+
+		return newExitError(lgtm.RenderSpec(ctx, spec))
+	},
+}
+
+func init() {
+	renderCmd.Flags().StringVar(&specPath, "spec", "", "spec file path (.json, .yaml or .yml) (required)")
+	renderCmd.MarkFlagRequired("spec")
+	renderCmd.Flags().StringVarP(&specInput, "input", "i", "", "input image path or http(s) URL (optional, overrides the spec)")
+	renderCmd.Flags().StringVarP(&specOutput, "output", "o", "", "output file path (optional, overrides the spec)")
+	renderCmd.Flags().DurationVar(&specTimeout, "timeout", 0, "abort rendering after this duration, e.g. '30s' (optional, default: no timeout)")
+	rootCmd.AddCommand(renderCmd)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCmd(t *testing.T) {
+	dir := t.TempDir()
+	input, err := filepath.Abs("testdata/lunch.jpg")
+	require.NoError(t, err)
+
+	spec := filepath.Join(dir, "ship-it.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte(`input: `+input+`
+output: out/ship-it.jpg
+layers:
+  - type: concentration_lines
+    color: white
+  - type: text
+    text: SHIP IT
+    color: "#ffcc00"
+    y: 0.8
+    size: 0.1
+  - type: sticker
+    image: gopher
+    x: 0.85
+    y: 0.85
+    width: 0.2
+`), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "out"), 0o755))
+	broken := filepath.Join(dir, "broken.yaml")
+	require.NoError(t, os.WriteFile(broken, []byte("layers:\n  - type: sparkles\n"), 0o644))
+
+	override := filepath.Join(dir, "override.jpg")
+
+	tests := []struct {
+		name     string
+		args     []string
+		output   string
+		wantCode int
+	}{
+		{
+			name:   "spec output",
+			args:   []string{"render", "--spec", spec},
+			output: filepath.Join(dir, "out", "ship-it.jpg"),
+		},
+		{
+			name:   "output flag overrides spec",
+			args:   []string{"render", "--spec", spec, "-o", override},
+			output: override,
+		},
+		{
+			name:     "invalid spec",
+			args:     []string{"render", "--spec", broken},
+			wantCode: exitUsage,
+		},
+		{
+			name:     "missing spec",
+			args:     []string{"render", "--spec", filepath.Join(dir, "missing.yaml")},
+			wantCode: exitUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specInput, specOutput, specTimeout = "", "", 0
+
+			rootCmd.SetArgs(tt.args)
+			rootCmd.SetOut(io.Discard)
+			rootCmd.SetErr(io.Discard)
+			defer rootCmd.SetArgs(nil)
+
+			err := rootCmd.Execute()
+			assert.Equal(t, tt.wantCode, exitCode(err), "error: %v", err)
+			if tt.output != "" {
+				assert.FileExists(t, tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package lgtm
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// openGIF はGIFの全フレームをデコードする
+func openGIF(path string) (*gif.GIF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, newError(StageDecode, path, nil, err)
+	}
+	defer file.Close()
+
+	g, err := gif.DecodeAll(file)
+	if err != nil {
+		return nil, newError(StageDecode, path, ErrDecode, err)
+	}
+	return g, nil
+}
+
+// saveGIF はGIFをoutputPathに書き込む。エラーには入力パスを付ける
+func saveGIF(g *gif.GIF, inputPath, outputPath string) error {
+	out, err := os.Create(outputPath)
+	if err != nil {
+		return newError(StageWrite, inputPath, ErrOutputWrite, err)
+	}
+
+	if err := gif.EncodeAll(out, g); err != nil {
+		out.Close()
+		return newError(StageWrite, inputPath, ErrOutputWrite, err)
+	}
+	if err := out.Close(); err != nil {
+		return newError(StageWrite, inputPath, ErrOutputWrite, err)
+	}
+	return nil
+}
+
+// openImage はEXIFの向きを反映して静止画をデコードする
+func openImage(path string) (image.Image, error) {
+	img, err := imaging.Open(path, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, newError(StageDecode, path, ErrDecode, err)
+	}
+	return img, nil
+}
+
+// saveImage は出力パスの拡張子のフォーマットで静止画を書き込む。エラーには入力パスを付ける
+func saveImage(img image.Image, inputPath, outputPath string) error {
+	if err := imaging.Save(img, outputPath); err != nil {
+		return newError(StageWrite, inputPath, ErrOutputWrite, err)
+	}
+	return nil
+}
+
+// DefaultOutputPath は出力パスが指定されなかった場合の出力先を返す
+// カレントディレクトリに「入力ファイル名-suffix.format」として出力する
+func DefaultOutputPath(inputPath, suffix, format string) string {
+	filename := filepath.Base(inputPath)
+	name := strings.Split(filename, ".")[0]
+	return filepath.Join(".", fmt.Sprintf("%s-%s.%s", name, suffix, format))
+}
@@ -1,19 +1,10 @@
 package lgtm
 
 import (
-	"fmt"
-	"image"
+	"context"
 	"image/color"
-	"image/draw"
-	"image/gif"
 	"math"
-	"math/rand"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
 
-	"github.com/disintegration/imaging"
 	"github.com/fogleman/gg"
 )
 
@@ -22,6 +13,10 @@ type ConcentrationLinesDrawer struct {
 	OutputPath string
 	LineCount  int         // 集中線の本数
 	LineColor  color.Color // 線の色
+	Seed       int64       // 線の配置の乱数シード（0なら描画のたびに変わる）
+	Focus      *Point      // 線が集まる点（nilなら画像の中心。被写体に合わせる場合はSaliencyMap.Focusの点を指定する）
+	Workers    int         // GIFのフレームを並列に描画するゴルーチン数（0以下ならGOMAXPROCS）
+	Limits     Limits      // デコード前に検査する入力画像の上限
 }
 
 func NewConcentrationLinesDrawer(inputPath, outputPath string) Drawer {
@@ -30,6 +25,7 @@ func NewConcentrationLinesDrawer(inputPath, outputPath string) Drawer {
 		OutputPath: outputPath,
 		LineCount:  200,         // デフォルトの線の本数（密度をさらに上げる）
 		LineColor:  color.Black, // デフォルトは黒
+		Limits:     DefaultLimits,
 	}
 }
 
@@ -38,113 +34,27 @@ func (c *ConcentrationLinesDrawer) SetLineColor(clr color.Color) {
 }
 
 func (c *ConcentrationLinesDrawer) Draw() error {
-	ext, err := c.extension(c.InputPath)
-	if err != nil {
-		return err
-	}
-
-	if ext == "gif" {
-		return c.drawOnGIF(c.InputPath, c.OutputPath)
-	}
-	return c.drawOnImage(c.InputPath, c.OutputPath, ext)
-}
-
-func (c *ConcentrationLinesDrawer) extension(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	_, format, err := image.DecodeConfig(f)
-	if err != nil {
-		return "", err
-	}
-
-	return format, nil
-}
-
-func (c *ConcentrationLinesDrawer) newFilename(inputPath, outputPath, ext string) string {
-	if outputPath != "" {
-		return outputPath
-	}
-	filename := filepath.Base(inputPath)
-	name := strings.Split(filename, ".")[0]
-	suffix := "concentration"
-	return filepath.Join(".", fmt.Sprintf("%s-%s.%s", name, suffix, ext))
-}
-
-func (c *ConcentrationLinesDrawer) drawOnGIF(inputPath, outputPath string) error {
-	file, err := os.Open(inputPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	orgGif, err := gif.DecodeAll(file)
-	if err != nil {
-		return err
-	}
-
-	newImage := make([]*image.Paletted, 0, len(orgGif.Image))
-	for _, v := range orgGif.Image {
-		v := v
-		img := c.drawConcentrationLines(v)
-
-		palettedImage := &image.Paletted{
-			Pix:     v.Pix,
-			Stride:  v.Stride,
-			Rect:    v.Bounds(),
-			Palette: v.Palette,
-		}
-		draw.Draw(palettedImage, palettedImage.Rect, img, img.Bounds().Min, draw.Over)
-		newImage = append(newImage, palettedImage)
-	}
-	orgGif.Image = newImage
-
-	out, err := os.Create(c.newFilename(inputPath, outputPath, "gif"))
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	if err := gif.EncodeAll(out, orgGif); err != nil {
-		return err
-	}
-
-	return nil
+	return c.DrawContext(context.Background())
 }
 
-func (c *ConcentrationLinesDrawer) drawOnImage(inputPath, outputPath, ext string) error {
-	img, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
-	if err != nil {
-		return err
-	}
-
-	result := c.drawConcentrationLines(img)
-
-	if err := imaging.Save(result, c.newFilename(inputPath, outputPath, ext)); err != nil {
-		return err
-	}
-
-	return nil
+func (c *ConcentrationLinesDrawer) DrawContext(ctx context.Context) error {
+	return drawEffect(ctx, c.InputPath, c.OutputPath, "concentration", c.Workers, c.Limits, c.Focus, c.drawConcentrationLines)
 }
 
-func (c *ConcentrationLinesDrawer) drawConcentrationLines(img image.Image) image.Image {
-	imgWidth := img.Bounds().Dx()
-	imgHeight := img.Bounds().Dy()
-	dc := gg.NewContext(imgWidth, imgHeight)
-	dc.DrawImage(img, 0, 0)
+func (c *ConcentrationLinesDrawer) drawConcentrationLines(dc *gg.Context, index int, focus Point) {
+	imgWidth := dc.Width()
+	imgHeight := dc.Height()
 
-	// 画像の中心点
-	centerX := float64(imgWidth) / 2
-	centerY := float64(imgHeight) / 2
+	// 線が集まる点
+	centerX := focus.X
+	centerY := focus.Y
 
 	// 画像の対角線の長さ（線が画像全体をカバーするため）
 	maxDistance := math.Sqrt(float64(imgWidth*imgWidth + imgHeight*imgHeight))
+	// 線が集まる点から最も遠い画像の角までの距離（中心の場合は対角線の半分）
+	farthest := farthestCorner(imgWidth, imgHeight, focus)
 
-	// ランダムシードを初期化
-	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rng := frameRand(c.Seed, index)
 
 	// 角度をランダムに生成
 	angles := make([]float64, c.LineCount)
@@ -155,8 +65,8 @@ func (c *ConcentrationLinesDrawer) drawConcentrationLines(img image.Image) image
 	for i := 0; i < c.LineCount; i++ {
 		angle := angles[i]
 
-		// 外側は必ず画像の端から（maxDistanceを使用）
-		outerDistance := maxDistance * 0.6 // 画像の端まで到達
+		// 外側は必ず画像の端から（最も遠い角より外側）
+		outerDistance := farthest * 1.2 // 画像の端まで到達
 		outerX := centerX + math.Cos(angle)*outerDistance
 		outerY := centerY + math.Sin(angle)*outerDistance
 
@@ -187,6 +97,4 @@ func (c *ConcentrationLinesDrawer) drawConcentrationLines(img image.Image) image
 		dc.ClosePath()
 		dc.Fill()
 	}
-
-	return dc.Image()
 }
@@ -0,0 +1,54 @@
+package lgtm
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEffectFocus(t *testing.T) {
+	img := busyImage(400, 300, image.Rect(280, 180, 360, 260))
+	assert.Equal(t, Point{X: 200, Y: 150}, effectFocus(img.Bounds(), nil))
+
+	// 被写体の位置に線を集める
+	subject := NewSaliencyMap(img).Focus()
+	focus := effectFocus(img.Bounds(), &subject)
+	assert.InDelta(t, 320, focus.X, 20)
+	assert.InDelta(t, 220, focus.Y, 20)
+
+	assert.Equal(t, Point{X: 10, Y: 20}, effectFocus(img.Bounds(), &Point{X: 10, Y: 20}))
+}
+
+func TestConcentrationLinesDrawer_OffCenter(t *testing.T) {
+	const width, height = 400, 300
+	focus := Point{X: 320, Y: 220}
+	d := &ConcentrationLinesDrawer{LineCount: 300, LineColor: color.Black, Seed: 1}
+	dc := gg.NewContext(width, height)
+	dc.SetColor(color.White)
+	dc.Clear()
+	d.drawConcentrationLines(dc, 0, focus)
+	img := dc.Image()
+
+	// 線が集まる点の周りは空け、遠い角まで線を描く
+	inner := 0.15 * math.Hypot(width, height)
+	farCorner := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, _, _, _ := img.At(x, y).RGBA()
+			if r == 0xffff {
+				continue
+			}
+			if math.Hypot(float64(x)-focus.X, float64(y)-focus.Y) < inner-1 {
+				t.Fatalf("pixel (%d, %d) is drawn near the focus", x, y)
+			}
+			if x < 40 && y < 40 {
+				farCorner++
+			}
+		}
+	}
+	assert.Positive(t, farCorner)
+}
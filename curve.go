@@ -0,0 +1,222 @@
+package lgtm
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+	gotext "github.com/go-text/typesetting/font"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// transformed は回転または円弧に沿って描くテキストかどうかを返す
+func (t *Text) transformed() bool {
+	return t.Rotation != 0 || t.Arc != 0
+}
+
+// validateTransform は回転角と円弧の中心角を検査する
+func (t *Text) validateTransform() error {
+	if math.IsNaN(t.Rotation) || math.IsInf(t.Rotation, 0) {
+		return fmt.Errorf("invalid rotation %v: must be a finite number of degrees", t.Rotation)
+	}
+	if math.IsNaN(t.Arc) || t.Arc < -360 || t.Arc > 360 {
+		return fmt.Errorf("invalid arc %v: must be between -360 and 360 degrees", t.Arc)
+	}
+	return nil
+}
+
+// placedGlyph は回転・円弧・縦書きに配置した1文字
+// 位置はテキストのPointからの相対位置で、グリフの範囲の中心が原点になる
+type placedGlyph struct {
+	r       rune
+	outline []gotext.Segment // シェーピングしたグリフの輪郭（nilならrをggで描く）
+	image   image.Image      // 絵文字の画像（outlineとrより優先する）
+	scale   float64          // 絵文字の画像の拡大率
+	x, y    float64          // ベースライン上の描画開始位置
+	angle   float64          // 時計回りの回転角（ラジアン）
+}
+
+// glyphRun はベースライン上に1列に並べた1文字（シェーピングした場合は1グリフ）
+type glyphRun struct {
+	r       rune
+	outline []gotext.Segment
+	image   image.Image
+	scale   float64
+	start   float64 // ベースライン上の開始位置
+	dy      float64 // ベースラインからの縦のずれ（結合文字の位置の調整）
+	advance float64
+	bounds  rect // ドットからのグリフの範囲
+}
+
+// placeGlyphs はテキストを1文字ずつ並べて回転し、描画されるグリフの範囲を返す
+// 縦書きの場合は上から下へ積み、それ以外は円弧に沿って並べる
+func placeGlyphs(face font.Face, t *Text, vertical bool, em float64) ([]placedGlyph, rect, error) {
+	var glyphs []placedGlyph
+	var bounds []rect
+	if vertical {
+		glyphs, bounds = stackGlyphs(face, t, em)
+	} else {
+		runs, width := runeRuns(face, t)
+		var err error
+		switch {
+		case t.hasEmoji():
+			runs, width, err = emojiRuns(face, t, em)
+		case t.shaped():
+			runs, width, err = shapedRuns(t, em)
+		}
+		if err != nil {
+			return nil, rect{}, err
+		}
+		glyphs, bounds = arcGlyphs(runs, width, t.Arc)
+	}
+
+	// 全体をPointを中心に回転する
+	rotation := t.Rotation * math.Pi / 180
+	ink := emptyRect()
+	for i := range glyphs {
+		g := &glyphs[i]
+		g.x, g.y = rotate(g.x, g.y, rotation)
+		g.angle += rotation
+		ink = ink.union(bounds[i].transform(g.x, g.y, g.angle))
+	}
+
+	// グリフの範囲の中心を原点に合わせる
+	if !ink.empty() {
+		dx, dy := (ink.minX+ink.maxX)/2, (ink.minY+ink.maxY)/2
+		for i := range glyphs {
+			glyphs[i].x -= dx
+			glyphs[i].y -= dy
+		}
+		ink = ink.offset(-dx, -dy)
+	}
+	return glyphs, ink, nil
+}
+
+// runeRuns はテキストを1文字ずつベースライン上に並べ、全体の送り幅を返す
+// 送り幅にはカーニングを含め、フォントにないグリフはggの描画と同じく飛ばす
+func runeRuns(face font.Face, t *Text) ([]glyphRun, float64) {
+	var runs []glyphRun
+	width := 0.0
+	prev := rune(-1)
+	for _, r := range t.Text.String() {
+		if prev >= 0 {
+			width += float64(face.Kern(prev, r)) / 64
+		}
+		b, a, ok := face.GlyphBounds(r)
+		if !ok {
+			continue
+		}
+		runs = append(runs, glyphRun{r: r, start: width, advance: float64(a) / 64, bounds: fixedRect(b)})
+		width += float64(a) / 64
+		prev = r
+	}
+	return runs, width
+}
+
+// arcGlyphs はベースライン上に並べた文字を中心角arc（度）の円弧に沿わせ、各文字とドットからのグリフの範囲を返す
+func arcGlyphs(runs []glyphRun, width, arcDegrees float64) ([]placedGlyph, []rect) {
+	arc := arcDegrees * math.Pi / 180
+	glyphs := make([]placedGlyph, 0, len(runs))
+	bounds := make([]rect, 0, len(runs))
+	for _, g := range runs {
+		// 文字の中心の、文字列の中心からのベースライン上の距離
+		mid := g.start + g.advance/2 - width/2
+		cx, cy, angle := mid, 0.0, 0.0
+		if arc != 0 && width > 0 {
+			// 文字列全体がarcの中心角の円弧になる半径の円に沿わせる
+			// 正なら円の中心は下にあり上に凸、負なら円の中心は上にあり下に凸になる
+			radius := width / math.Abs(arc)
+			phi := mid / radius
+			sign := math.Copysign(1, arc)
+			cx, cy = radius*math.Sin(phi), sign*radius*(1-math.Cos(phi))
+			angle = sign * phi
+		}
+		// 文字の中心から描画開始位置に戻す
+		x, y := rotate(-g.advance/2, g.dy, angle)
+		glyphs = append(glyphs, placedGlyph{r: g.r, outline: g.outline, image: g.image, scale: g.scale, x: cx + x, y: cy + y, angle: angle})
+		bounds = append(bounds, g.bounds)
+	}
+	return glyphs, bounds
+}
+
+// drawGlyphs は配置済みの各文字を(x, y)を基準に回転して描画する
+func drawGlyphs(dc *gg.Context, glyphs []placedGlyph, x, y float64) {
+	for _, g := range glyphs {
+		gx, gy := x+g.x, y+g.y
+		dc.Push()
+		dc.RotateAbout(g.angle, gx, gy)
+		switch {
+		case g.image != nil:
+			// 画像の上端はベースラインからemojiAscentだけ上にある
+			dc.Translate(gx, gy-float64(g.image.Bounds().Dy())*g.scale*emojiAscent)
+			dc.Scale(g.scale, g.scale)
+			dc.DrawImage(g.image, -g.image.Bounds().Min.X, -g.image.Bounds().Min.Y)
+		case g.outline != nil:
+			drawOutline(dc, g.outline, gx, gy)
+		default:
+			dc.DrawString(string(g.r), gx, gy)
+		}
+		dc.Pop()
+	}
+}
+
+func fixedRect(b fixed.Rectangle26_6) rect {
+	return rect{float64(b.Min.X) / 64, float64(b.Min.Y) / 64, float64(b.Max.X) / 64, float64(b.Max.Y) / 64}
+}
+
+func rotate(x, y, angle float64) (float64, float64) {
+	sin, cos := math.Sincos(angle)
+	return x*cos - y*sin, x*sin + y*cos
+}
+
+// rect は小数の座標の矩形
+type rect struct {
+	minX, minY, maxX, maxY float64
+}
+
+func emptyRect() rect {
+	return rect{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+}
+
+func (r rect) empty() bool {
+	return r.minX >= r.maxX || r.minY >= r.maxY
+}
+
+func (r rect) union(o rect) rect {
+	if o.empty() {
+		return r
+	}
+	return rect{math.Min(r.minX, o.minX), math.Min(r.minY, o.minY), math.Max(r.maxX, o.maxX), math.Max(r.maxY, o.maxY)}
+}
+
+func (r rect) offset(dx, dy float64) rect {
+	return rect{r.minX + dx, r.minY + dy, r.maxX + dx, r.maxY + dy}
+}
+
+// transform は矩形の4隅をangleだけ回転して(x, y)に移動した範囲を返す
+func (r rect) transform(x, y, angle float64) rect {
+	if r.empty() {
+		return r
+	}
+	out := emptyRect()
+	for _, c := range [][2]float64{{r.minX, r.minY}, {r.maxX, r.minY}, {r.minX, r.maxY}, {r.maxX, r.maxY}} {
+		cx, cy := rotate(c[0], c[1], angle)
+		out.minX, out.minY = math.Min(out.minX, x+cx), math.Min(out.minY, y+cy)
+		out.maxX, out.maxY = math.Max(out.maxX, x+cx), math.Max(out.maxY, y+cy)
+	}
+	return out
+}
+
+// pixels は(x, y)に移動した矩形を含む整数の矩形を返す
+// ggはバイリニア補間で回転したグリフを描くため、1px広く取る
+func (r rect) pixels(x, y float64) image.Rectangle {
+	if r.empty() {
+		return image.Rect(int(x), int(y), int(x), int(y))
+	}
+	return image.Rect(
+		int(math.Floor(x+r.minX))-1, int(math.Floor(y+r.minY))-1,
+		int(math.Ceil(x+r.maxX))+1, int(math.Ceil(y+r.maxY))+1,
+	)
+}
@@ -0,0 +1,117 @@
+package lgtm
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceGlyphs(t *testing.T) {
+	face, err := NotoSansMono.FontFace(40)
+	require.NoError(t, err)
+	defer face.Close()
+
+	em := 40.0 * fontDPI / 72
+
+	text := NewMainText(DefaultMainText, TextColorWhite)
+	_, straight, err := placeGlyphs(face, text, false, em)
+	require.NoError(t, err)
+
+	text.Rotation = 90
+	glyphs, rotated, _ := placeGlyphs(face, text, false, em)
+	require.Len(t, glyphs, len([]rune(text.Text.String())))
+	// 90度回転すると幅と高さが入れ替わり、文字は上から下に並ぶ
+	assert.InDelta(t, straight.maxX-straight.minX, rotated.maxY-rotated.minY, 1)
+	assert.InDelta(t, straight.maxY-straight.minY, rotated.maxX-rotated.minX, 1)
+	assert.Less(t, glyphs[0].y, glyphs[len(glyphs)-1].y)
+	assert.InDelta(t, math.Pi/2, glyphs[0].angle, 1e-9)
+
+	// 円弧の両端の文字は中央の文字より下にあり、外側に傾く
+	text.Rotation, text.Arc = 0, 120
+	glyphs, arc, _ := placeGlyphs(face, text, false, em)
+	first, middle, last := glyphs[0], glyphs[len(glyphs)/2], glyphs[len(glyphs)-1]
+	assert.Greater(t, first.y, middle.y)
+	assert.Greater(t, last.y, middle.y)
+	assert.Less(t, first.angle, 0.0)
+	assert.Greater(t, last.angle, 0.0)
+	assert.Greater(t, arc.maxY-arc.minY, straight.maxY-straight.minY)
+
+	// 下に凸の円弧は上下が逆になる
+	text.Arc = -120
+	glyphs, _, _ = placeGlyphs(face, text, false, em)
+	assert.Less(t, glyphs[0].y, glyphs[len(glyphs)/2].y)
+	assert.Greater(t, glyphs[0].angle, 0.0)
+
+	// グリフの範囲の中心が原点になる
+	for _, r := range []rect{rotated, arc} {
+		assert.InDelta(t, 0, (r.minX+r.maxX)/2, 1e-6)
+		assert.InDelta(t, 0, (r.minY+r.maxY)/2, 1e-6)
+	}
+}
+
+func TestText_ValidateTransform(t *testing.T) {
+	text := NewMainText(DefaultMainText, TextColorWhite)
+	for _, tt := range []struct{ rotation, arc float64 }{{0, 0}, {-45, 0}, {720, 360}, {0, -360}} {
+		text.Rotation, text.Arc = tt.rotation, tt.arc
+		assert.NoError(t, text.validateTransform(), "%+v", tt)
+	}
+	for _, tt := range []struct{ rotation, arc float64 }{{math.NaN(), 0}, {math.Inf(1), 0}, {0, 361}, {0, math.NaN()}} {
+		text.Rotation, text.Arc = tt.rotation, tt.arc
+		assert.Error(t, text.validateTransform(), "%+v", tt)
+	}
+}
+
+func TestLayout_Transformed(t *testing.T) {
+	tests := []struct {
+		width, height int
+		rotation, arc float64
+	}{
+		{400, 300, 30, 0},
+		{400, 300, -90, 0},
+		{400, 300, 0, 150},
+		{400, 300, 0, -90},
+		{400, 300, 45, 360},
+		{120, 800, 90, 0},
+		{1000, 100, 10, 60},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d rotation=%v arc=%v", tt.width, tt.height, tt.rotation, tt.arc), func(t *testing.T) {
+			canvas := image.Rect(0, 0, tt.width, tt.height)
+			main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+			for _, text := range []*Text{main, sub} {
+				text.Rotation, text.Arc = tt.rotation, tt.arc
+			}
+			d := &TextDrawer{MainText: main, SubText: sub}
+			layout, err := d.layout(context.Background(), canvas)
+			require.NoError(t, err)
+			for _, b := range layout.Boxes() {
+				assert.True(t, b.Bounds.In(canvas), "%q %v overflows the image", b.Text.Text, b.Bounds)
+			}
+			assert.False(t, layout.Main.Bounds.Overlaps(layout.Sub.Bounds))
+
+			// 実際に描画したピクセルがBoundsに収まる
+			render, err := d.renderer(layout)
+			require.NoError(t, err)
+			dc := gg.NewContext(tt.width, tt.height)
+			dc.SetColor(color.Black)
+			dc.Clear()
+			require.NoError(t, render(dc, 0))
+			img := dc.Image()
+			inside := layout.Main.Bounds.Union(layout.Sub.Bounds)
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					if r, _, _, _ := img.At(x, y).RGBA(); r > 0 && !image.Pt(x, y).In(inside) {
+						t.Fatalf("pixel (%d, %d) is drawn outside %v", x, y, inside)
+					}
+				}
+			}
+		})
+	}
+}
@@ -1,5 +1,26 @@
 package lgtm
 
+import "context"
+
 type Drawer interface {
 	Draw() error
 }
+
+// ContextDrawer は描画を途中で中断できるDrawer
+type ContextDrawer interface {
+	Drawer
+	// DrawContext はctxがキャンセルされるとフレーム間やレイアウト計算の合間で描画を中断し、ctx.Err()を返す
+	DrawContext(ctx context.Context) error
+}
+
+// DrawContext はdがContextDrawerならDrawContextで描画する
+// それ以外のDrawerは途中で中断できないため、描画を始める前にだけctxを確認してDrawを呼ぶ
+func DrawContext(ctx context.Context, d Drawer) error {
+	if cd, ok := d.(ContextDrawer); ok {
+		return cd.DrawContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return d.Draw()
+}
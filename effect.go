@@ -0,0 +1,166 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/fogleman/gg"
+	"github.com/pkg/errors"
+)
+
+// Effect は画像に重ねる漫画の効果の種類
+type Effect string
+
+const (
+	EffectConcentration Effect = "concentration" // 中心に向かう集中線
+	EffectSpeedLines    Effect = "speed"         // 平行な流線
+	EffectBetaFlash     Effect = "beta"          // 周りを塗りつぶして白い光を放射するベタフラッシュ
+	EffectScreentone    Effect = "screentone"    // 外側ほど大きくなる網点のスクリーントーン
+	EffectImpactBurst   Effect = "burst"         // ギザギザの爆発の吹き出し
+)
+
+// Effects は選べる効果の一覧
+var Effects = []Effect{EffectConcentration, EffectSpeedLines, EffectBetaFlash, EffectScreentone, EffectImpactBurst}
+
+// EffectOptions はNewEffectDrawerで作る効果に共通の設定
+// 0の項目は各Drawerのデフォルト値を使い、使わない項目は無視する
+type EffectOptions struct {
+	Color color.Color // 線や網点の色（爆発の吹き出しは枠線の色）
+	Focus *Point      // 効果の中心（流線では使わない）
+	Angle float64     // 流線の向き（度。流線以外では使わない）
+	Seed  int64       // 乱数シード（0なら描画のたびに変わる）
+}
+
+// NewEffectDrawer は効果の種類に対応するDrawerを作成する
+func NewEffectDrawer(effect Effect, inputPath, outputPath string, opts EffectOptions) (ContextDrawer, error) {
+	switch effect {
+	case EffectConcentration:
+		d := NewConcentrationLinesDrawer(inputPath, outputPath).(*ConcentrationLinesDrawer)
+		d.Focus, d.Seed = opts.Focus, opts.Seed
+		if opts.Color != nil {
+			d.LineColor = opts.Color
+		}
+		return d, nil
+	case EffectSpeedLines:
+		d := NewSpeedLinesDrawer(inputPath, outputPath).(*SpeedLinesDrawer)
+		d.Angle, d.Seed = opts.Angle, opts.Seed
+		if opts.Color != nil {
+			d.LineColor = opts.Color
+		}
+		return d, nil
+	case EffectBetaFlash:
+		d := NewBetaFlashDrawer(inputPath, outputPath).(*BetaFlashDrawer)
+		d.Focus, d.Seed = opts.Focus, opts.Seed
+		if opts.Color != nil {
+			d.Color = opts.Color
+		}
+		return d, nil
+	case EffectScreentone:
+		d := NewScreentoneDrawer(inputPath, outputPath).(*ScreentoneDrawer)
+		d.Focus = opts.Focus
+		if opts.Color != nil {
+			d.DotColor = opts.Color
+		}
+		return d, nil
+	case EffectImpactBurst:
+		d := NewImpactBurstDrawer(inputPath, outputPath).(*ImpactBurstDrawer)
+		d.Focus, d.Seed = opts.Focus, opts.Seed
+		if opts.Color != nil {
+			// 吹き出しの中に同じ色の文字を書けるよう、中は反対の明るさで塗る
+			d.LineColor, d.FillColor = opts.Color, contrastColor(opts.Color)
+		}
+		return d, nil
+	}
+	return nil, errors.Errorf("unknown effect %q", effect)
+}
+
+// effectFrame は1フレームに効果を描く。focusは全フレームで共通の効果の中心
+type effectFrame func(dc *gg.Context, index int, focus Point)
+
+// drawEffect は静止画またはGIFの全フレームに効果を描き、出力先に保存する
+// 効果の中心はfocus（nilなら画像の中心。GIFは画面の中心）で、全フレームで共通にする
+func drawEffect(ctx context.Context, inputPath, outputPath, suffix string, workers int, limits Limits, focus *Point, draw effectFrame) error {
+	ext, err := inspect(inputPath, limits)
+	if err != nil {
+		return err
+	}
+	if outputPath == "" {
+		outputPath = DefaultOutputPath(inputPath, suffix, ext)
+	}
+
+	if ext == "gif" {
+		g, err := openGIF(inputPath)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		center := effectFocus(gifScreen(g), focus)
+		err = drawFrames(ctx, g, workers, func() (frameRenderer, error) {
+			return func(dc *gg.Context, i int) error {
+				draw(dc, i, center)
+				return nil
+			}, nil
+		})
+		if err != nil {
+			return newError(StageRender, inputPath, nil, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return saveGIF(g, inputPath, outputPath)
+	}
+
+	img, err := openImage(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dc := newCanvas(img)
+	draw(dc, 0, effectFocus(img.Bounds(), focus))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return saveImage(dc.Image(), inputPath, outputPath)
+}
+
+// frameRand はフレームごとの乱数を返す。seedが0なら現在時刻を使う
+// 並列に描画するフレームが同じ乱数列にならないよう、シードにフレーム番号を加える
+func frameRand(seed int64, index int) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed + int64(index)))
+}
+
+// effectFocus は効果の中心を返す。pointを指定した場合はその点、それ以外はboundsの中心を返す
+func effectFocus(bounds image.Rectangle, point *Point) Point {
+	if point != nil {
+		return *point
+	}
+	return Point{X: float64(bounds.Dx()) / 2, Y: float64(bounds.Dy()) / 2}
+}
+
+// farthestCorner はpから最も遠いキャンバスの角までの距離を返す
+func farthestCorner(width, height int, p Point) float64 {
+	farthest := 0.0
+	for _, corner := range []Point{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		farthest = math.Max(farthest, math.Hypot(corner.X-p.X, corner.Y-p.Y))
+	}
+	return farthest
+}
+
+// contrastColor は明るい色には黒、暗い色には白を返す
+func contrastColor(c color.Color) color.Color {
+	if color.GrayModel.Convert(c).(color.Gray).Y >= 128 {
+		return color.Black
+	}
+	return color.White
+}
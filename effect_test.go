@@ -0,0 +1,136 @@
+package lgtm
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEffectDrawer(t *testing.T) {
+	focus := &Point{X: 10, Y: 20}
+	opts := EffectOptions{Color: color.White, Focus: focus, Angle: 30, Seed: 7}
+
+	tests := []struct {
+		effect Effect
+		want   Drawer
+	}{
+		{
+			effect: EffectConcentration,
+			want:   &ConcentrationLinesDrawer{InputPath: "in.jpg", OutputPath: "out.jpg", LineCount: 200, LineColor: color.White, Focus: focus, Seed: 7, Limits: DefaultLimits},
+		},
+		{
+			effect: EffectSpeedLines,
+			want:   &SpeedLinesDrawer{InputPath: "in.jpg", OutputPath: "out.jpg", LineCount: 120, LineColor: color.White, Angle: 30, Seed: 7, Limits: DefaultLimits},
+		},
+		{
+			effect: EffectBetaFlash,
+			want:   &BetaFlashDrawer{InputPath: "in.jpg", OutputPath: "out.jpg", LineCount: 360, Color: color.White, Focus: focus, Seed: 7, Limits: DefaultLimits},
+		},
+		{
+			effect: EffectScreentone,
+			want:   &ScreentoneDrawer{InputPath: "in.jpg", OutputPath: "out.jpg", DotColor: color.White, Angle: 45, Focus: focus, Limits: DefaultLimits},
+		},
+		{
+			// 白い枠線の吹き出しは中を黒で塗る
+			effect: EffectImpactBurst,
+			want:   &ImpactBurstDrawer{InputPath: "in.jpg", OutputPath: "out.jpg", FillColor: color.Black, LineColor: color.White, Spikes: 18, Focus: focus, Seed: 7, Limits: DefaultLimits},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.effect), func(t *testing.T) {
+			d, err := NewEffectDrawer(tt.effect, "in.jpg", "out.jpg", opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, d)
+		})
+	}
+
+	_, err := NewEffectDrawer("sparkle", "in.jpg", "out.jpg", opts)
+	assert.EqualError(t, err, `unknown effect "sparkle"`)
+}
+
+// drawEffectOnWhite は白いキャンバスにdrawで効果を描いた画像を返す
+func drawEffectOnWhite(width, height int, focus Point, draw effectFrame) image.Image {
+	dc := gg.NewContext(width, height)
+	dc.SetColor(color.White)
+	dc.Clear()
+	draw(dc, 0, focus)
+	return dc.Image()
+}
+
+// darkRatio はrectの中で暗いピクセルの割合を返す
+func darkRatio(img image.Image, rect image.Rectangle) float64 {
+	dark := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128 {
+				dark++
+			}
+		}
+	}
+	return float64(dark) / float64(rect.Dx()*rect.Dy())
+}
+
+func TestSpeedLinesDrawer_Angle(t *testing.T) {
+	// 水平な線は縦に短く、横に長く連なる
+	d := &SpeedLinesDrawer{LineCount: 40, LineColor: color.Black, Seed: 1}
+	img := drawEffectOnWhite(400, 300, Point{}, d.drawSpeedLines)
+	rows, cols := 0, 0
+	for y := 0; y < 300; y++ {
+		if darkRatio(img, image.Rect(0, y, 400, y+1)) > 0 {
+			rows++
+		}
+	}
+	for x := 0; x < 400; x++ {
+		if darkRatio(img, image.Rect(x, 0, x+1, 300)) > 0.3 {
+			cols++
+		}
+	}
+	assert.Positive(t, rows)
+	assert.Zero(t, cols)
+
+	// 垂直な線は列に沿って連なる
+	d.Angle = 90
+	img = drawEffectOnWhite(400, 300, Point{}, d.drawSpeedLines)
+	for y := 0; y < 300; y++ {
+		assert.LessOrEqual(t, darkRatio(img, image.Rect(0, y, 400, y+1)), 0.3)
+	}
+}
+
+func TestBetaFlashDrawer_Center(t *testing.T) {
+	focus := Point{X: 200, Y: 150}
+	d := &BetaFlashDrawer{LineCount: 360, Color: color.Black, Seed: 1}
+	img := drawEffectOnWhite(400, 300, focus, d.drawBetaFlash)
+
+	// 中心は残し、角は塗りつぶす
+	inner := int(0.2 * math.Hypot(400, 300))
+	assert.Zero(t, darkRatio(img, image.Rect(200-inner/2, 150-inner/2, 200+inner/2, 150+inner/2)))
+	assert.Greater(t, darkRatio(img, image.Rect(0, 0, 40, 40)), 0.95)
+}
+
+func TestScreentoneDrawer_Dots(t *testing.T) {
+	focus := Point{X: 100, Y: 100}
+	d := &ScreentoneDrawer{DotColor: color.Black, Spacing: 8, Angle: 45}
+	img := drawEffectOnWhite(400, 300, focus, d.drawScreentone)
+
+	// 中心の近くには描かず、遠い角ほど網点が大きい
+	assert.Zero(t, darkRatio(img, image.Rect(60, 60, 140, 140)))
+	near := darkRatio(img, image.Rect(0, 260, 40, 300))
+	far := darkRatio(img, image.Rect(360, 260, 400, 300))
+	assert.Positive(t, near)
+	assert.Greater(t, far, near)
+}
+
+func TestImpactBurstDrawer_Balloon(t *testing.T) {
+	focus := Point{X: 200, Y: 150}
+	d := &ImpactBurstDrawer{FillColor: color.Black, LineColor: color.Black, Spikes: 18, Seed: 1}
+	img := drawEffectOnWhite(400, 300, focus, d.drawImpactBurst)
+
+	// 付け根より内側は塗りつぶし、吹き出しの外の角には描かない
+	assert.Equal(t, 1.0, darkRatio(img, image.Rect(120, 90, 280, 210)))
+	assert.Zero(t, darkRatio(img, image.Rect(0, 0, 10, 10)))
+}
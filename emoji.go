@@ -0,0 +1,350 @@
+package lgtm
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-text/typesetting/di"
+	gotext "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// EmojiSource はカラー絵文字の画像を返す
+// sequenceは異体字セレクタやZWJを含む1つの絵文字の文字列
+type EmojiSource interface {
+	Emoji(sequence string) (image.Image, bool)
+}
+
+// LoadEmoji は絵文字のPNG画像のディレクトリか、CBDT・sbixのカラー絵文字フォントを読み込む
+func LoadEmoji(path string) (EmojiSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, newError(StageInspect, path, nil, err)
+	}
+	if info.IsDir() {
+		return EmojiDir(path), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, newError(StageInspect, path, nil, err)
+	}
+	src, err := NewEmojiFont(data)
+	if err != nil {
+		return nil, &Error{Path: path, Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+	}
+	return src, nil
+}
+
+// emojiDir はTwemojiやNoto Emojiのように、コードポイントをファイル名にしたPNG画像のディレクトリ
+type emojiDir struct {
+	path  string
+	mu    sync.Mutex
+	cache map[string]image.Image // 見つからなかった絵文字はnil
+}
+
+// EmojiDir は絵文字のPNG画像のディレクトリを絵文字の画像に使う
+// ファイル名は "1f389.png" や "1f468-200d-1f469.png"（Twemoji）、"emoji_u1f389.png"（Noto Emoji）の形式で、
+// 異体字セレクタ（U+FE0F）を含む名前と含まない名前の両方を探す
+func EmojiDir(path string) EmojiSource {
+	return &emojiDir{path: path, cache: map[string]image.Image{}}
+}
+
+func (d *emojiDir) Emoji(sequence string) (image.Image, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if img, ok := d.cache[sequence]; ok {
+		return img, img != nil
+	}
+
+	var img image.Image
+	for _, name := range emojiFileNames(sequence) {
+		f, err := os.Open(filepath.Join(d.path, name))
+		if err != nil {
+			continue
+		}
+		decoded, _, err := image.Decode(f)
+		f.Close()
+		if err == nil {
+			img = decoded
+			break
+		}
+	}
+	d.cache[sequence] = img
+	return img, img != nil
+}
+
+// emojiFileNames は絵文字の画像のファイル名の候補を返す
+func emojiFileNames(sequence string) []string {
+	var all, stripped []string
+	for _, r := range sequence {
+		hex := fmt.Sprintf("%x", r)
+		all = append(all, hex)
+		if r != variationSelector16 {
+			stripped = append(stripped, hex)
+		}
+	}
+	return []string{
+		strings.Join(all, "-") + ".png",
+		strings.Join(stripped, "-") + ".png",
+		"emoji_u" + strings.Join(stripped, "_") + ".png",
+		"emoji_u" + strings.Join(all, "_") + ".png",
+	}
+}
+
+// emojiFont はCBDT・sbixのビットマップを持つカラー絵文字フォント
+type emojiFont struct {
+	face   *gotext.Face
+	mu     sync.Mutex
+	shaper shaping.HarfbuzzShaper
+	cache  map[string]image.Image // 見つからなかった絵文字はnil
+}
+
+// NewEmojiFont はCBDT・sbixのカラー絵文字フォントを絵文字の画像に使う
+// ZWJで結合した絵文字はフォントの合字で1つのグリフにする。COLRのベクターの絵文字には対応しない
+func NewEmojiFont(data []byte) (EmojiSource, error) {
+	face, err := gotext.ParseTTF(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &emojiFont{face: face, cache: map[string]image.Image{}}, nil
+}
+
+func (f *emojiFont) Emoji(sequence string) (image.Image, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if img, ok := f.cache[sequence]; ok {
+		return img, img != nil
+	}
+
+	var img image.Image
+	text := []rune(sequence)
+	out := f.shaper.Shape(shaping.Input{
+		Text:      text,
+		RunEnd:    len(text),
+		Direction: di.DirectionLTR,
+		Face:      f.face,
+		Size:      fixed.I(int(f.face.Upem())),
+	})
+	// 1つのグリフにならない絵文字はフォントにない
+	if len(out.Glyphs) == 1 && out.Glyphs[0].GlyphID != 0 {
+		if bitmap, ok := f.face.GlyphData(out.Glyphs[0].GlyphID).(gotext.GlyphBitmap); ok && (bitmap.Format == gotext.PNG || bitmap.Format == gotext.JPG) {
+			if decoded, _, err := image.Decode(bytes.NewReader(bitmap.Data)); err == nil {
+				img = decoded
+			}
+		}
+	}
+	f.cache[sequence] = img
+	return img, img != nil
+}
+
+const (
+	zeroWidthJoiner     = '\u200d'
+	variationSelector15 = '\ufe0e'
+	variationSelector16 = '\ufe0f'
+	combiningKeycap     = '\u20e3'
+)
+
+// emojiAscent は絵文字の画像の上端のベースラインからの高さ（emに対する比率）
+// 残りの0.15emはベースラインより下に出る
+const emojiAscent = 0.85
+
+// textSegment は絵文字とそれ以外の文字列に分けたテキストの一部
+type textSegment struct {
+	text  string
+	emoji bool
+}
+
+// splitEmoji はテキストを絵文字1つずつと、それ以外の文字列に分ける
+// 絵文字には肌の色の修飾子・異体字セレクタ・タグ・ZWJで結合した絵文字、2文字の国旗、キーキャップを含める
+// U+2190〜U+2BFFの矢印や記号、©・®などはU+FE0Fが続く場合だけ絵文字にする
+func splitEmoji(s string) []textSegment {
+	var segments []textSegment
+	text := []rune(s)
+	plain := 0
+	flush := func(end int) {
+		if plain < end {
+			segments = append(segments, textSegment{text: string(text[plain:end])})
+		}
+	}
+	for i := 0; i < len(text); {
+		n := emojiLength(text[i:])
+		if n == 0 {
+			i++
+			continue
+		}
+		flush(i)
+		segments = append(segments, textSegment{text: string(text[i : i+n]), emoji: true})
+		i += n
+		plain = i
+	}
+	flush(len(text))
+	return segments
+}
+
+// emojiLength はtextの先頭の絵文字の文字数を返す。絵文字で始まらない場合は0を返す
+func emojiLength(text []rune) int {
+	next := func(i int) rune {
+		if i < len(text) {
+			return text[i]
+		}
+		return -1
+	}
+
+	r := text[0]
+	switch {
+	case isRegionalIndicator(r):
+		if isRegionalIndicator(next(1)) {
+			return 2
+		}
+		return 0
+	case r == '#' || r == '*' || r >= '0' && r <= '9':
+		// キーキャップ
+		switch {
+		case next(1) == variationSelector16 && next(2) == combiningKeycap:
+			return 3
+		case next(1) == combiningKeycap:
+			return 2
+		}
+		return 0
+	case isPictograph(r):
+	case isEmojiSymbol(r) && next(1) == variationSelector16:
+	default:
+		return 0
+	}
+
+	n := 1
+	for n < len(text) {
+		c := text[n]
+		switch {
+		case c == variationSelector16 || c == variationSelector15 || isSkinTone(c) || isEmojiTag(c):
+			n++
+		case c == zeroWidthJoiner && n+1 < len(text) && (isPictograph(text[n+1]) || isEmojiSymbol(text[n+1])):
+			n += 2
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// isPictograph は常に絵文字として描く絵文字の面（U+1F000〜U+1FAFF）の文字かどうかを返す
+func isPictograph(r rune) bool {
+	return r >= 0x1f000 && r <= 0x1faff && !isRegionalIndicator(r) && !isSkinTone(r)
+}
+
+// isEmojiSymbol はU+FE0Fが続くと絵文字になる記号かどうかを返す
+func isEmojiSymbol(r rune) bool {
+	return r >= 0x2190 && r <= 0x2bff || r == 0xa9 || r == 0xae || r == 0x203c || r == 0x2049 || r == 0x2122 || r == 0x2139 || r == 0x3030 || r == 0x303d
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1f1e6 && r <= 0x1f1ff }
+func isSkinTone(r rune) bool          { return r >= 0x1f3fb && r <= 0x1f3ff }
+func isEmojiTag(r rune) bool          { return r >= 0xe0020 && r <= 0xe007f }
+
+// hasEmoji は絵文字の画像で描く絵文字を含むテキストかどうかを返す
+func (t *Text) hasEmoji() bool {
+	if t.Emoji == nil {
+		return false
+	}
+	for _, s := range splitEmoji(string(t.Text)) {
+		if s.emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// emojiRuns は絵文字を画像に、それ以外の文字列をフォントのグリフにしてベースライン上に1列に並べ、全体の送り幅を返す
+// 絵文字の画像は高さをemに合わせ、画像がない絵文字はフォントで描く
+// シェーピングしないテキストはPaddingTextと同じく、絵文字の前後にも空白を入れる
+func emojiRuns(face font.Face, t *Text, em float64) ([]glyphRun, float64, error) {
+	var runs []glyphRun
+	width := 0.0
+	space := 0.0
+	if !t.shaped() {
+		if a, ok := face.GlyphAdvance(' '); ok {
+			space = float64(a) / 64
+		}
+	}
+
+	for i, s := range splitEmoji(string(t.Text)) {
+		if i > 0 {
+			width += space
+		}
+		if s.emoji {
+			if img, ok := t.Emoji.Emoji(s.text); ok && img.Bounds().Dy() > 0 {
+				w := em * float64(img.Bounds().Dx()) / float64(img.Bounds().Dy())
+				runs = append(runs, glyphRun{
+					image:   img,
+					scale:   em / float64(img.Bounds().Dy()),
+					start:   width,
+					advance: w,
+					bounds:  rect{minX: 0, minY: -em * emojiAscent, maxX: w, maxY: em * (1 - emojiAscent)},
+				})
+				width += w
+				continue
+			}
+		}
+
+		// 絵文字以外の文字列は絵文字を含まないテキストと同じく並べる
+		part := *t
+		part.Text = PaddingText(s.text)
+		part.Emoji = nil
+		partRuns, partWidth := runeRuns(face, &part)
+		if part.shaped() {
+			var err error
+			if partRuns, partWidth, err = shapedRuns(&part, em); err != nil {
+				return nil, 0, err
+			}
+		}
+		for _, r := range partRuns {
+			r.start += width
+			runs = append(runs, r)
+		}
+		width += partWidth
+	}
+	return runs, width, nil
+}
+
+// emojiClusters は縦書きで1文字ずつ積むために、テキストを絵文字1つずつと1文字ずつに分ける
+func emojiClusters(t *Text) []textSegment {
+	if t.Emoji == nil {
+		var clusters []textSegment
+		for _, r := range string(t.Text) {
+			clusters = append(clusters, textSegment{text: string(r)})
+		}
+		return clusters
+	}
+	var clusters []textSegment
+	for _, s := range splitEmoji(string(t.Text)) {
+		if s.emoji {
+			clusters = append(clusters, s)
+			continue
+		}
+		for _, r := range s.text {
+			clusters = append(clusters, textSegment{text: string(r)})
+		}
+	}
+	return clusters
+}
+
+// inkWidth は並べたグリフが占める幅を返す
+func inkWidth(runs []glyphRun) float64 {
+	ink := emptyRect()
+	for _, r := range runs {
+		ink = ink.union(r.bounds.offset(r.start, r.dy))
+	}
+	if ink.empty() {
+		return 0
+	}
+	return ink.maxX - ink.minX
+}
@@ -0,0 +1,167 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitEmoji(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []textSegment
+	}{
+		{"plain", "LGTM", []textSegment{{text: "LGTM"}}},
+		{"trailing", "LGTM 🎉", []textSegment{{text: "LGTM "}, {text: "🎉", emoji: true}}},
+		{"adjacent", "🎉🚀", []textSegment{{text: "🎉", emoji: true}, {text: "🚀", emoji: true}}},
+		{"skin tone", "👍🏽ok", []textSegment{{text: "👍🏽", emoji: true}, {text: "ok"}}},
+		{"zwj", "a👨‍👩‍👧b", []textSegment{{text: "a"}, {text: "👨‍👩‍👧", emoji: true}, {text: "b"}}},
+		{"flag", "🇯🇵", []textSegment{{text: "🇯🇵", emoji: true}}},
+		{"keycap", "1️⃣ 2", []textSegment{{text: "1️⃣", emoji: true}, {text: " 2"}}},
+		{"symbol with vs16", "❤️!", []textSegment{{text: "❤️", emoji: true}, {text: "!"}}},
+		{"symbol without vs16", "❤ ©", []textSegment{{text: "❤ ©"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitEmoji(tt.text))
+		})
+	}
+}
+
+func TestEmojiDir(t *testing.T) {
+	dir := t.TempDir()
+	red := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(red, red.Bounds(), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	for _, name := range []string{"1f389.png", "2764-fe0f.png", "emoji_u1f44d_1f3fd.png"} {
+		writePNG(t, filepath.Join(dir, name), red)
+	}
+	src := EmojiDir(dir)
+
+	for _, seq := range []string{"🎉", "❤️", "👍🏽", "🎉️"} {
+		_, ok := src.Emoji(seq)
+		assert.True(t, ok, "%q", seq)
+	}
+	_, ok := src.Emoji("🚀")
+	assert.False(t, ok)
+
+	// 一度探した結果はキャッシュする
+	require.NoError(t, os.Remove(filepath.Join(dir, "1f389.png")))
+	_, ok = src.Emoji("🎉")
+	assert.True(t, ok)
+}
+
+func TestLoadEmoji(t *testing.T) {
+	src, err := LoadEmoji("testdata/emoji")
+	require.NoError(t, err)
+	_, ok := src.Emoji("🎉")
+	assert.True(t, ok)
+
+	_, err = LoadEmoji("testdata/missing")
+	assert.Error(t, err)
+
+	// CBDT・sbixのフォントとして読めないファイル
+	_, err = LoadEmoji("testdata/images/pattern_checker.png")
+	assert.ErrorIs(t, err, ErrFontLoad)
+
+	src, err = LoadEmoji("testdata/sbix-emoji.ttf")
+	require.NoError(t, err)
+	_, ok = src.Emoji("🎉")
+	assert.True(t, ok)
+}
+
+func TestEmojiFont(t *testing.T) {
+	// 🎉・👨・👩と、👨‍👩の合字をPNGで、⭐をTIFFで持つsbixのフォント。Aにはグリフはあるがビットマップはない
+	data, err := os.ReadFile("testdata/sbix-emoji.ttf")
+	require.NoError(t, err)
+	src, err := NewEmojiFont(data)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		sequence string
+		want     color.Color // nilなら見つからない
+	}{
+		{name: "single", sequence: "🎉", want: color.RGBA{R: 255, A: 255}},
+		{name: "zwj ligature", sequence: "👨‍👩", want: color.RGBA{R: 255, G: 255, A: 255}},
+		{name: "zwj without ligature", sequence: "👩‍👨"},
+		{name: "not in cmap", sequence: "🚀"},
+		{name: "no bitmap", sequence: "A"},
+		{name: "unsupported bitmap format", sequence: "⭐"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, ok := src.Emoji(tt.sequence)
+			if tt.want == nil {
+				assert.False(t, ok)
+				assert.Nil(t, img)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, image.Rect(0, 0, 4, 4), img.Bounds())
+			assert.Equal(t, tt.want, color.RGBAModel.Convert(img.At(1, 1)))
+		})
+	}
+
+	_, err = NewEmojiFont([]byte("not a font"))
+	assert.Error(t, err)
+}
+
+func TestLayout_Emoji(t *testing.T) {
+	canvas := image.Rect(0, 0, 400, 300)
+	emoji := EmojiDir("testdata/emoji")
+	main, sub := NewMainText("LGTM🎉", TextColorWhite), NewSubText("Looks Good 🎉", TextColorWhite)
+	main.Emoji, sub.Emoji = emoji, emoji
+
+	// 絵文字の画像の幅も測る
+	plain := NewMainText("LGTM🎉", TextColorWhite)
+	face, err := NotoSansMono.FontFace(40)
+	require.NoError(t, err)
+	defer face.Close()
+	assert.Greater(t, main.measureTextWidth(face, 40), plain.measureTextWidth(face, 40))
+
+	d := &TextDrawer{MainText: main, SubText: sub}
+	layout, err := d.layout(context.Background(), canvas)
+	require.NoError(t, err)
+	for _, b := range layout.Boxes() {
+		require.NotEmpty(t, b.glyphs)
+		last := b.glyphs[len(b.glyphs)-1]
+		require.NotNil(t, last.image)
+		// 絵文字の高さはフォントサイズのemに合わせる
+		assert.InDelta(t, b.FontSize*fontDPI/72, float64(last.image.Bounds().Dy())*last.scale, 1e-9)
+		assert.True(t, b.Bounds.In(canvas), "%q %v overflows the image", b.Text.Text, b.Bounds)
+	}
+	assert.False(t, layout.Main.Bounds.Overlaps(layout.Sub.Bounds))
+
+	// 絵文字は文字色ではなく画像の色で描く
+	render, err := d.renderer(layout)
+	require.NoError(t, err)
+	dc := gg.NewContext(canvas.Dx(), canvas.Dy())
+	dc.SetColor(color.Black)
+	dc.Clear()
+	require.NoError(t, render(dc, 0))
+	img := dc.Image()
+	inside := layout.Main.Bounds.Union(layout.Sub.Bounds)
+	colored := 0
+	for y := 0; y < canvas.Dy(); y++ {
+		for x := 0; x < canvas.Dx(); x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if r|g|b == 0 {
+				continue
+			}
+			require.True(t, image.Pt(x, y).In(inside), "pixel (%d, %d) is drawn outside %v", x, y, inside)
+			if r != g || g != b {
+				colored++
+			}
+		}
+	}
+	assert.Positive(t, colored)
+}
@@ -0,0 +1,81 @@
+package lgtm
+
+import (
+	"context"
+	"fmt"
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+)
+
+// Drawerが返すエラーの種類
+// errors.Is で判定でき、入力パスや処理段階は errors.As で *Error として取り出せる
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrDecode            = errors.New("failed to decode image")
+	ErrFontLoad          = errors.New("failed to load font")
+	ErrOutputWrite       = errors.New("failed to write output")
+	ErrTextOverflow      = errors.New("text does not fit in the image")
+)
+
+// Stage はエラーが発生した処理段階
+type Stage string
+
+const (
+	StageFetch   Stage = "fetch"   // URLからのダウンロード
+	StageInspect Stage = "inspect" // ファイルサイズ・ヘッダの検査
+	StageDecode  Stage = "decode"  // 画像のデコード
+	StageLayout  Stage = "layout"  // フォントの読み込みとレイアウト計算
+	StageRender  Stage = "render"  // 描画
+	StageWrite   Stage = "write"   // 出力ファイルへの書き込み
+)
+
+// Error は入力パスと処理段階を付けて原因のエラーをラップする
+type Error struct {
+	Path  string // 入力画像のパス（ダウンロードではURL）
+	Stage Stage
+	Kind  error // ErrDecode などのエラーの種類（分類できない場合はnil）
+	Err   error // 原因のエラー
+}
+
+func (e *Error) Error() string {
+	if e.Kind == nil {
+		return fmt.Sprintf("%s %s: %v", e.Stage, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v: %v", e.Stage, e.Path, e.Kind, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// newError はerrをstageとpathでラップする
+// errが既に *Error の場合は段階と種類を保ったまま、入力パスだけ補って返す
+// キャンセルによるエラーはctx.Err()のまま返す
+func newError(stage Stage, path string, kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Path == "" {
+			e.Path = path
+		}
+		return err
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		kind = ErrLimitExceeded
+	}
+	if errors.Is(err, image.ErrFormat) || errors.Is(err, imaging.ErrUnsupportedFormat) {
+		kind = ErrUnsupportedFormat
+	}
+	return &Error{Path: path, Stage: stage, Kind: kind, Err: err}
+}
@@ -0,0 +1,96 @@
+package lgtm
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrawer_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	notImage := filepath.Join(dir, "not_image.jpg")
+	require.NoError(t, os.WriteFile(notImage, []byte("not an image"), 0o644))
+
+	truncatedGIF := filepath.Join(dir, "truncated.gif")
+	writeTestGIF(t, truncatedGIF, 3, 64, 64)
+	b, err := os.ReadFile(truncatedGIF)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(truncatedGIF, b[:len(b)/2], 0o644))
+
+	tests := []struct {
+		name       string
+		inputPath  string
+		outputPath string
+		font       Font
+		wantKind   error
+		wantStage  Stage
+	}{
+		{
+			name:      "存在しない入力ファイル",
+			inputPath: filepath.Join(dir, "nonexistent.jpg"),
+			wantKind:  fs.ErrNotExist,
+			wantStage: StageInspect,
+		},
+		{
+			name:      "画像ではないファイル",
+			inputPath: notImage,
+			wantKind:  ErrUnsupportedFormat,
+			wantStage: StageInspect,
+		},
+		{
+			name:      "途中で切れたGIF",
+			inputPath: truncatedGIF,
+			wantKind:  ErrDecode,
+			wantStage: StageInspect,
+		},
+		{
+			name:      "壊れたフォント",
+			inputPath: "testdata/images/test_small.jpg",
+			font:      Font("broken"),
+			wantKind:  ErrFontLoad,
+			wantStage: StageLayout,
+		},
+		{
+			name:       "書き込めない出力先",
+			inputPath:  "testdata/images/test_small.jpg",
+			outputPath: filepath.Join(dir, "missing", "output.jpg"),
+			wantKind:   ErrOutputWrite,
+			wantStage:  StageWrite,
+		},
+		{
+			name:       "出力フォーマットが未対応",
+			inputPath:  "testdata/images/test_small.jpg",
+			outputPath: filepath.Join(dir, "output.unknown"),
+			wantKind:   ErrUnsupportedFormat,
+			wantStage:  StageWrite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			main := NewMainText(DefaultMainText, TextColorWhite)
+			sub := NewSubText(DefaultSubText, TextColorWhite)
+			if tt.font != nil {
+				main.Font = tt.font
+			}
+			outputPath := tt.outputPath
+			if outputPath == "" {
+				outputPath = filepath.Join(dir, "output.jpg")
+			}
+
+			err := NewTextDrawer(main, sub, tt.inputPath, outputPath).Draw()
+			assert.ErrorIs(t, err, tt.wantKind)
+
+			var e *Error
+			require.True(t, errors.As(err, &e))
+			assert.Equal(t, tt.inputPath, e.Path)
+			assert.Equal(t, tt.wantStage, e.Stage)
+			assert.Contains(t, err.Error(), tt.inputPath)
+		})
+	}
+}
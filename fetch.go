@@ -0,0 +1,145 @@
+package lgtm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFetch はURLからの画像の取得に失敗した場合のエラー
+var ErrFetch = errors.New("failed to fetch image")
+
+// FetchOptions は FromURL のダウンロード設定
+// 0の項目はデフォルト値を使う
+type FetchOptions struct {
+	Client       *http.Client  // リクエストに使うクライアント（nilならhttp.DefaultClient）
+	MaxBytes     int64         // ダウンロードサイズの上限（デフォルトはDefaultLimits.MaxFileSize）
+	Timeout      time.Duration // ダウンロード全体のタイムアウト（デフォルトは30秒）
+	MaxRedirects int           // リダイレクトの最大回数（デフォルトは5回、負の値ならリダイレクトしない）
+}
+
+// fetchExtensions はダウンロードを許可する画像のContent-Typeと保存するファイルの拡張子
+var fetchExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+// IsURL はパスがhttpまたはhttpsのURLかどうかを判定する
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// FromURL は画像をダウンロードして一時ディレクトリに保存し、そのパスを返す
+// Content-Typeはレスポンスヘッダではなく本文から判定し、JPEG・PNG・GIF以外は ErrUnsupportedFormat を返す
+// 保存したファイルはcleanupで削除する
+func FromURL(ctx context.Context, rawURL string, opts FetchOptions) (string, func(), error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, fmt.Errorf("unsupported scheme %q", u.Scheme))
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultLimits.MaxFileSize
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	res, err := fetchClient(opts).Do(req)
+	if err != nil {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, fmt.Errorf("unexpected status %s", res.Status))
+	}
+	if err := check("download size", res.ContentLength, maxBytes); err != nil {
+		return "", nil, newError(StageFetch, rawURL, nil, err)
+	}
+
+	// 上限を1バイト超えて読めたらサイズ超過
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBytes+1))
+	if err != nil {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	if err := check("download size", int64(len(body)), maxBytes); err != nil {
+		return "", nil, newError(StageFetch, rawURL, nil, err)
+	}
+
+	contentType := http.DetectContentType(body)
+	ext, ok := fetchExtensions[contentType]
+	if !ok {
+		return "", nil, newError(StageFetch, rawURL, ErrUnsupportedFormat, fmt.Errorf("content type %q", contentType))
+	}
+
+	dir, err := os.MkdirTemp("", "lgtm-fetch-*")
+	if err != nil {
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	// 出力ファイル名の元になるため、リダイレクト後のURLのファイル名を残して保存する
+	filename := filepath.Join(dir, fetchFilename(res.Request.URL, ext))
+	if err := os.WriteFile(filename, body, 0o600); err != nil {
+		cleanup()
+		return "", nil, newError(StageFetch, rawURL, ErrFetch, err)
+	}
+	return filename, cleanup, nil
+}
+
+// fetchClient はリダイレクト回数を制限したクライアントを返す
+// 呼び出し側のクライアントは変更せず、浅いコピーにCheckRedirectを設定する
+func fetchClient(opts FetchOptions) *http.Client {
+	client := http.DefaultClient
+	if opts.Client != nil {
+		client = opts.Client
+	}
+	maxRedirects := opts.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = 5
+	}
+
+	c := *client
+	checkRedirect := client.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", max(maxRedirects, 0))
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		return nil
+	}
+	return &c
+}
+
+// fetchFilename はURLのパスから拡張子を除いたファイル名を取り出し、判定した拡張子を付ける
+func fetchFilename(u *url.URL, ext string) string {
+	name := strings.Split(path.Base(u.Path), ".")[0]
+	if name == "" || name == "/" {
+		name = "image"
+	}
+	return name + "." + ext
+}
@@ -0,0 +1,110 @@
+package lgtm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromURL(t *testing.T) {
+	jpg, err := os.ReadFile("testdata/images/test_small.jpg")
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/cat.png", func(w http.ResponseWriter, r *http.Request) {
+		// Content-Typeヘッダではなく本文から判定する
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(jpg)
+	})
+	mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+		// Content-Lengthを付けずに送る
+		w.(http.Flusher).Flush()
+		w.Write(jpg)
+	})
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		fmt.Fprint(w, "not an image")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	mux.HandleFunc("/redirect/", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		fmt.Sscanf(r.URL.Path, "/redirect/%d", &n)
+		if n == 0 {
+			http.Redirect(w, r, "/images/cat.png", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		opts     FetchOptions
+		wantName string
+		wantErr  error
+	}{
+		{name: "画像を取得できる", path: "/images/cat.png", wantName: "cat.jpg"},
+		{name: "Content-Lengthなし", path: "/chunked", wantName: "chunked.jpg"},
+		{name: "リダイレクト上限以内", path: "/redirect/3", wantName: "cat.jpg"},
+		{name: "リダイレクト上限超過", path: "/redirect/3", opts: FetchOptions{MaxRedirects: 2}, wantErr: ErrFetch},
+		{name: "リダイレクト禁止", path: "/redirect/0", opts: FetchOptions{MaxRedirects: -1}, wantErr: ErrFetch},
+		{name: "存在しない", path: "/notfound", wantErr: ErrFetch},
+		{name: "画像ではない", path: "/text", wantErr: ErrUnsupportedFormat},
+		{name: "サイズ超過", path: "/images/cat.png", opts: FetchOptions{MaxBytes: 100}, wantErr: ErrLimitExceeded},
+		{name: "サイズ超過 Content-Lengthなし", path: "/chunked", opts: FetchOptions{MaxBytes: 100}, wantErr: ErrLimitExceeded},
+		{name: "タイムアウト", path: "/slow", opts: FetchOptions{Timeout: 50 * time.Millisecond}, wantErr: context.DeadlineExceeded},
+		{name: "クライアントを差し替えられる", path: "/images/cat.png", opts: FetchOptions{Client: srv.Client()}, wantName: "cat.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup, err := FromURL(context.Background(), srv.URL+tt.path, tt.opts)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer cleanup()
+
+			assert.Equal(t, tt.wantName, filepath.Base(path))
+			got, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, jpg, got)
+
+			cleanup()
+			assert.NoFileExists(t, path)
+		})
+	}
+}
+
+func TestFromURL_InvalidURL(t *testing.T) {
+	_, _, err := FromURL(context.Background(), "ftp://example.com/cat.jpg", FetchOptions{})
+	assert.ErrorIs(t, err, ErrFetch)
+
+	var e *Error
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, StageFetch, e.Stage)
+	assert.Equal(t, "ftp://example.com/cat.jpg", e.Path)
+}
+
+func TestIsURL(t *testing.T) {
+	assert.True(t, IsURL("https://example.com/cat.jpg"))
+	assert.True(t, IsURL("http://example.com/cat.jpg"))
+	assert.False(t, IsURL("cat.jpg"))
+	assert.False(t, IsURL("/tmp/https://cat.jpg"))
+}
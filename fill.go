@@ -0,0 +1,146 @@
+package lgtm
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// FillType はテキストの塗り方
+type FillType string
+
+const (
+	FillSolid    FillType = "solid"    // 単色
+	FillLinear   FillType = "linear"   // 左から右への線形グラデーション
+	FillVertical FillType = "vertical" // 上から下への線形グラデーション
+	FillRadial   FillType = "radial"   // 中心から外側への円形グラデーション
+	FillPattern  FillType = "pattern"  // 画像を敷き詰めた模様
+)
+
+// Fill はテキストの塗り
+// グラデーションと模様はテキストのバウンディングボックスを基準に広げる
+// GIFのフレームは元のパレットのまま描くため、グラデーションの色はパレットの最も近い色になる
+type Fill struct {
+	Type   FillType
+	Colors []color.Color // solidは1色、グラデーションは等間隔に並べる2色以上
+	Image  image.Image   // patternで敷き詰める画像
+}
+
+// ParseFill は "linear:#ff0000,#0000ff" のような塗りの指定を解釈する
+// 種類を省略して色だけを指定した場合は単色、patternは "pattern:path/to/image.png" のように画像のパスを指定する
+func ParseFill(s string) (*Fill, error) {
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok {
+		kind, value = string(FillSolid), s
+	}
+
+	f := &Fill{Type: FillType(kind)}
+	switch f.Type {
+	case FillPattern:
+		if value == "" {
+			return nil, fmt.Errorf("invalid fill %q: pattern requires an image path", s)
+		}
+		if _, err := inspect(value, DefaultLimits); err != nil {
+			return nil, err
+		}
+		img, err := openImage(value)
+		if err != nil {
+			return nil, err
+		}
+		f.Image = img
+		return f, nil
+	case FillSolid, FillLinear, FillVertical, FillRadial:
+	default:
+		return nil, fmt.Errorf("invalid fill %q: must be a color or one of solid, linear, vertical, radial, pattern followed by ':'", s)
+	}
+
+	for _, c := range strings.Split(value, ",") {
+		parsed, err := ParseColor(strings.TrimSpace(c))
+		if err != nil {
+			return nil, fmt.Errorf("invalid fill %q: %w", s, err)
+		}
+		f.Colors = append(f.Colors, parsed)
+	}
+	if err := f.validate(); err != nil {
+		return nil, fmt.Errorf("invalid fill %q: %w", s, err)
+	}
+	return f, nil
+}
+
+// validate は塗りの種類に必要な色や画像があるかを検査する
+func (f *Fill) validate() error {
+	switch f.Type {
+	case FillSolid:
+		if len(f.Colors) != 1 {
+			return fmt.Errorf("solid requires exactly one color, got %d", len(f.Colors))
+		}
+	case FillLinear, FillVertical, FillRadial:
+		if len(f.Colors) < 2 {
+			return fmt.Errorf("%s gradient requires at least two colors, got %d", f.Type, len(f.Colors))
+		}
+	case FillPattern:
+		if f.Image == nil {
+			return fmt.Errorf("pattern requires an image")
+		}
+	default:
+		return fmt.Errorf("unknown fill type %q", f.Type)
+	}
+	return nil
+}
+
+// pattern は幅w・高さhの範囲を塗るggのパターンを返す
+func (f *Fill) pattern(w, h float64) gg.Pattern {
+	var g gg.Gradient
+	switch f.Type {
+	case FillSolid:
+		return gg.NewSolidPattern(f.Colors[0])
+	case FillPattern:
+		return gg.NewSurfacePattern(f.Image, gg.RepeatBoth)
+	case FillVertical:
+		g = gg.NewLinearGradient(0, 0, 0, h)
+	case FillRadial:
+		g = gg.NewRadialGradient(w/2, h/2, 0, w/2, h/2, math.Hypot(w, h)/2)
+	default:
+		g = gg.NewLinearGradient(0, 0, w, 0)
+	}
+	for i, c := range f.Colors {
+		g.AddColorStop(float64(i)/float64(len(f.Colors)-1), c)
+	}
+	return g
+}
+
+// filledText は塗りを指定したテキストの、フレームによらない描画内容
+// グリフの形のマスクと塗りの画像を一度だけ作り、各フレームには合成するだけにする
+type filledText struct {
+	bounds image.Rectangle
+	src    *image.RGBA
+	mask   *image.Alpha
+}
+
+func newFilledText(b *TextBox, face font.Face) *filledText {
+	// ggはバイリニア補間でグリフを描くため、バウンディングボックスより1px広く取る
+	bounds := b.Bounds.Inset(-1)
+	w, h := bounds.Dx(), bounds.Dy()
+
+	mc := gg.NewContext(w, h)
+	mc.SetFontFace(face)
+	mc.SetColor(color.White)
+	b.draw(mc, -float64(bounds.Min.X), -float64(bounds.Min.Y))
+
+	pc := gg.NewContext(w, h)
+	pc.SetFillStyle(b.Text.Fill.pattern(float64(w), float64(h)))
+	pc.DrawRectangle(0, 0, float64(w), float64(h))
+	pc.Fill()
+
+	return &filledText{bounds: bounds, src: pc.Image().(*image.RGBA), mask: mc.AsMask()}
+}
+
+func (f *filledText) draw(dc *gg.Context) {
+	draw.DrawMask(dc.Image().(draw.Image), f.bounds, f.src, image.Point{}, f.mask, image.Point{}, draw.Over)
+}
@@ -0,0 +1,77 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFill(t *testing.T) {
+	tests := []struct {
+		in     string
+		typ    FillType
+		colors int
+	}{
+		{in: "#ff0000", typ: FillSolid, colors: 1},
+		{in: "solid:white", typ: FillSolid, colors: 1},
+		{in: "linear:#ff0000,#0000ff", typ: FillLinear, colors: 2},
+		{in: "linear:#f00, #ff0, #0f0, #0ff, #00f", typ: FillLinear, colors: 5},
+		{in: "vertical:#eeeeee,#888888,#eeeeee", typ: FillVertical, colors: 3},
+		{in: "radial:white,#00000080", typ: FillRadial, colors: 2},
+	}
+	for _, tt := range tests {
+		f, err := ParseFill(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.typ, f.Type, tt.in)
+		assert.Len(t, f.Colors, tt.colors, tt.in)
+	}
+
+	f, err := ParseFill("pattern:testdata/images/test_rect_300x200.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, FillPattern, f.Type)
+	assert.Equal(t, image.Rect(0, 0, 300, 200), f.Image.Bounds())
+
+	for _, in := range []string{"", "red", "linear:#ff0000", "linear:#ff0000,red", "solid:#fff,#000", "conic:#fff,#000", "pattern:"} {
+		_, err := ParseFill(in)
+		assert.Error(t, err, in)
+	}
+	_, err = ParseFill("pattern:testdata/images/missing.png")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestFill_Solid(t *testing.T) {
+	// 単色の塗りはTextColorで描いた場合と同じ結果になる
+	canvas := image.Rect(0, 0, 400, 300)
+	render := func(text *Text) image.Image {
+		d := &TextDrawer{MainText: text}
+		layout, err := d.layout(context.Background(), canvas)
+		require.NoError(t, err)
+		r, err := d.renderer(layout)
+		require.NoError(t, err)
+
+		dc := gg.NewContext(canvas.Dx(), canvas.Dy())
+		dc.SetColor(color.Black)
+		dc.Clear()
+		require.NoError(t, r(dc, 0))
+		return dc.Image()
+	}
+
+	want := render(NewMainText(DefaultMainText, TextColorWhite))
+	filled := NewMainText(DefaultMainText, TextColorBlack)
+	filled.Fill = &Fill{Type: FillSolid, Colors: []color.Color{color.White}}
+	got := render(filled)
+
+	c := compareImages(want, got)
+	assert.LessOrEqual(t, c.maxDelta, 2, "solid fill differs from TextColor")
+
+	// 不正な塗りはレイアウトの前に報告する
+	filled.Fill = &Fill{Type: FillLinear, Colors: []color.Color{color.White}}
+	_, err := (&TextDrawer{MainText: filled}).layout(context.Background(), canvas)
+	assert.ErrorContains(t, err, "at least two colors")
+}
@@ -9,6 +9,9 @@ import (
 
 type Font []byte
 
+// fontDPI はフォントサイズをピクセルに換算する解像度
+const fontDPI = 96
+
 var (
 	//go:embed data/NotoSansMono-Bold.otf
 	NotoSansMono Font
@@ -17,7 +20,7 @@ var (
 func (f Font) FontFace(size float64) (font.Face, error) {
 	opts := &opentype.FaceOptions{
 		Size:    size,
-		DPI:     96,
+		DPI:     fontDPI,
 		Hinting: font.HintingNone,
 	}
 
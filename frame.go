@@ -0,0 +1,108 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/draw"
+	"image/gif"
+	"runtime"
+	"sync"
+
+	"github.com/fogleman/gg"
+)
+
+// frameRenderer は1フレーム分の描画処理
+// dcには元の画像（フレーム）が描画済みの論理スクリーンサイズのキャンバスが渡される
+type frameRenderer func(dc *gg.Context, index int) error
+
+// newCanvas は画像を描画したキャンバスを作成する
+func newCanvas(img image.Image) *gg.Context {
+	dc := gg.NewContext(img.Bounds().Dx(), img.Bounds().Dy())
+	dc.DrawImage(img, 0, 0)
+	return dc
+}
+
+// gifScreen はGIFの論理スクリーンの範囲を返す
+func gifScreen(g *gif.GIF) image.Rectangle {
+	screen := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if screen.Empty() && len(g.Image) > 0 {
+		screen = g.Image[0].Bounds()
+	}
+	return screen
+}
+
+// drawFrames はGIFの各フレームをworkers個のゴルーチンで並列に描画する
+// フォントフェイスなどゴルーチン間で共有できない状態を持てるよう、rendererはワーカーごとに生成する
+// フレームはその場で書き換えるため、順序・ディレイ・ディスポーザルは元のGIFのまま保持される
+// ctxがキャンセルされると次のフレームに進まずにctx.Err()を返す
+func drawFrames(ctx context.Context, g *gif.GIF, workers int, newRenderer func() (frameRenderer, error)) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(g.Image) {
+		workers = len(g.Image)
+	}
+	screen := gifScreen(g)
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	stop := make(chan struct{})
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(stop)
+		})
+	}
+
+	indexes := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			render, err := newRenderer()
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			// キャンバスはワーカーごとに1つだけ確保し、フレーム間で使い回す
+			canvas := image.NewRGBA(screen)
+			dc := gg.NewContextForRGBA(canvas)
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+				// 前のフレームの描画が残らないよう、キャンバス全体を透明に戻してから写す
+				frame := g.Image[i]
+				draw.Draw(canvas, canvas.Bounds(), image.Transparent, image.Point{}, draw.Src)
+				draw.Draw(canvas, frame.Rect, frame, frame.Rect.Min, draw.Src)
+				if err := render(dc, i); err != nil {
+					fail(err)
+					return
+				}
+				draw.Draw(frame, frame.Rect, canvas, frame.Rect.Min, draw.Over)
+			}
+		}()
+	}
+
+loop:
+	for i := range g.Image {
+		select {
+		case indexes <- i:
+		case <-stop:
+			break loop
+		case <-ctx.Done():
+			fail(ctx.Err())
+			break loop
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,130 @@
+package lgtm
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"sync"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFrames(frames int) *gif.GIF {
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{ColorModel: palette, Width: 16, Height: 16}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 16, 16), palette))
+		g.Delay = append(g.Delay, i)
+	}
+	return g
+}
+
+func TestDrawFrames(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{name: "逐次", workers: 1},
+		{name: "並列", workers: 4},
+		{name: "GOMAXPROCS", workers: 0},
+		{name: "フレーム数より多いワーカー", workers: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newTestFrames(20)
+			frames := append([]*image.Paletted{}, g.Image...)
+
+			var mu sync.Mutex
+			rendered := map[int]int{}
+			err := drawFrames(context.Background(), g, tt.workers, func() (frameRenderer, error) {
+				return func(dc *gg.Context, i int) error {
+					mu.Lock()
+					rendered[i]++
+					mu.Unlock()
+					// 奇数フレームだけ白で塗りつぶす
+					if i%2 == 1 {
+						dc.SetColor(color.White)
+						dc.Clear()
+					}
+					return nil
+				}, nil
+			})
+			assert.NoError(t, err)
+
+			for i, frame := range g.Image {
+				assert.Same(t, frames[i], frame)
+				assert.Equal(t, i, g.Delay[i])
+				assert.Equal(t, 1, rendered[i])
+				want := uint8(i % 2)
+				assert.Equal(t, want, frame.ColorIndexAt(0, 0), "frame %d", i)
+			}
+		})
+	}
+}
+
+func TestDrawFrames_Error(t *testing.T) {
+	wantErr := errors.New("render failed")
+
+	g := newTestFrames(50)
+	err := drawFrames(context.Background(), g, 4, func() (frameRenderer, error) {
+		return func(dc *gg.Context, i int) error {
+			if i == 10 {
+				return wantErr
+			}
+			return nil
+		}, nil
+	})
+	assert.ErrorIs(t, err, wantErr)
+
+	err = drawFrames(context.Background(), g, 4, func() (frameRenderer, error) {
+		return nil, wantErr
+	})
+	assert.ErrorIs(t, err, wantErr)
+}
+
+func TestDrawFrames_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	g := newTestFrames(50)
+	rendered := 0
+	err := drawFrames(ctx, g, 1, func() (frameRenderer, error) {
+		return func(dc *gg.Context, i int) error {
+			rendered++
+			if i == 9 {
+				cancel()
+			}
+			return nil
+		}, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 10, rendered)
+}
+
+func TestDrawFrames_ClearCanvas(t *testing.T) {
+	// 2枚目は画面の一部だけを覆うフレーム
+	g := newTestFrames(2)
+	g.Image[1] = image.NewPaletted(image.Rect(4, 4, 8, 8), g.Image[1].Palette)
+
+	var leftover color.Color
+	err := drawFrames(context.Background(), g, 1, func() (frameRenderer, error) {
+		return func(dc *gg.Context, i int) error {
+			if i == 0 {
+				dc.SetColor(color.White)
+				dc.Clear()
+				return nil
+			}
+			leftover = dc.Image().At(0, 0)
+			return nil
+		}, nil
+	})
+	assert.NoError(t, err)
+
+	// 前のフレームで塗った白がフレームの外に残っていない
+	_, _, _, a := leftover.RGBA()
+	assert.Zero(t, a)
+}
@@ -0,0 +1,448 @@
+package lgtm
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// go test -run TestGolden -update でtestdata/goldenの参照画像を作り直す
+var update = flag.Bool("update", false, "update golden images in testdata/golden")
+
+const (
+	goldenDir = "testdata/golden"
+	// 比較に失敗した場合の実際の描画結果と差分画像の出力先（コミットしない）
+	goldenFailureDir = "testdata/golden/failures"
+
+	// pixelTolerance はチャンネルごとの差がこの値以下のピクセルを一致とみなす
+	pixelTolerance = 16
+	// maxMismatchRatio は一致しないピクセルの割合の上限
+	maxMismatchRatio = 0.002
+	// minSSIM は輝度のSSIMの下限
+	minSSIM = 0.98
+)
+
+func TestGolden(t *testing.T) {
+	dir := t.TempDir()
+	input := "testdata/images/test_rect_300x200.jpg"
+	gifInput := filepath.Join(dir, "input.gif")
+	writeTestGIF(t, gifInput, 3, 120, 80)
+
+	tests := []struct {
+		name   string
+		drawer func(output string) Drawer
+		gif    bool
+	}{
+		{
+			name: "text_white",
+			drawer: func(output string) Drawer {
+				return NewTextDrawer(NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite), input, output)
+			},
+		},
+		{
+			name: "text_black_custom",
+			drawer: func(output string) Drawer {
+				return NewTextDrawer(NewMainText("SHIP IT", TextColorBlack), NewSubText("", TextColorBlack), input, output)
+			},
+		},
+		{
+			name: "text_background_box",
+			drawer: func(output string) Drawer {
+				bg := &Background{Style: BackgroundBox, Radius: 8}
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Background, sub.Background = bg, bg
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "text_background_scrim",
+			drawer: func(output string) Drawer {
+				main := NewMainText(DefaultMainText, TextColorBlack)
+				main.Background = &Background{Style: BackgroundScrim, Color: color.White, Opacity: 0.8}
+				return NewTextDrawer(main, NewSubText(DefaultSubText, TextColorBlack), input, output)
+			},
+		},
+		{
+			name: "text_fill_gradient",
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Fill = mustParseFill(t, "linear:#ff0000,#ffff00,#00ff00,#00ffff,#0000ff,#ff00ff")
+				sub.Fill = mustParseFill(t, "vertical:#ffffff,#808080,#e0e0e0")
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "text_fill_pattern",
+			drawer: func(output string) Drawer {
+				main := NewMainText(DefaultMainText, TextColorWhite)
+				main.Fill = mustParseFill(t, "pattern:testdata/images/pattern_checker.png")
+				main.Background = &Background{Style: BackgroundBox, Color: color.White, Opacity: 0.8}
+				return NewTextDrawer(main, NewSubText("", TextColorWhite), input, output)
+			},
+		},
+		{
+			name: "text_rotated",
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Rotation, sub.Rotation = -15, -15
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "text_arc",
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Arc, sub.Arc = 90, -120
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "text_vertical",
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText("(LGTM)", TextColorWhite), NewSubText("Looks good.", TextColorWhite)
+				main.WritingMode = WritingVertical
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "text_emoji",
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText("LGTM🎉", TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Emoji = EmojiDir("testdata/emoji")
+				return NewTextDrawer(main, sub, input, output)
+			},
+		},
+		{
+			name: "gopher",
+			drawer: func(output string) Drawer {
+				return NewGopherDrawer(input, output)
+			},
+		},
+		{
+			name: "concentration",
+			drawer: func(output string) Drawer {
+				d := NewConcentrationLinesDrawer(input, output).(*ConcentrationLinesDrawer)
+				d.Seed = 42
+				return d
+			},
+		},
+		{
+			name: "concentration_focus",
+			drawer: func(output string) Drawer {
+				d := NewConcentrationLinesDrawer(input, output).(*ConcentrationLinesDrawer)
+				d.Seed = 42
+				d.Focus = &Point{X: 210, Y: 70}
+				return d
+			},
+		},
+		{
+			name: "speed_lines",
+			drawer: func(output string) Drawer {
+				d := NewSpeedLinesDrawer(input, output).(*SpeedLinesDrawer)
+				d.Seed = 42
+				d.Angle = -20
+				return d
+			},
+		},
+		{
+			name: "beta_flash",
+			drawer: func(output string) Drawer {
+				d := NewBetaFlashDrawer(input, output).(*BetaFlashDrawer)
+				d.Seed = 42
+				return d
+			},
+		},
+		{
+			name: "screentone",
+			drawer: func(output string) Drawer {
+				return NewScreentoneDrawer(input, output)
+			},
+		},
+		{
+			name: "impact_burst",
+			drawer: func(output string) Drawer {
+				d := NewImpactBurstDrawer(input, output).(*ImpactBurstDrawer)
+				d.Seed = 42
+				return d
+			},
+		},
+		{
+			name: "gif_text",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				return NewTextDrawer(NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite), gifInput, output)
+			},
+		},
+		{
+			name: "gif_text_band",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Background = &Background{Style: BackgroundBand, Opacity: 0.6}
+				return NewTextDrawer(main, sub, gifInput, output)
+			},
+		},
+		{
+			name: "gif_text_fill_radial",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Fill = mustParseFill(t, "radial:#ffffff,#0000ff")
+				return NewTextDrawer(main, sub, gifInput, output)
+			},
+		},
+		{
+			name: "gif_text_arc",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+				main.Arc = 120
+				return NewTextDrawer(main, sub, gifInput, output)
+			},
+		},
+		{
+			name: "gif_gopher",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				return NewGopherDrawer(gifInput, output)
+			},
+		},
+		{
+			name: "gif_concentration",
+			gif:  true,
+			drawer: func(output string) Drawer {
+				d := NewConcentrationLinesDrawer(gifInput, output).(*ConcentrationLinesDrawer)
+				d.Seed = 42
+				d.SetLineColor(color.White)
+				return d
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.gif {
+				// 静止画はJPEGの劣化を避けるためPNGで出力して比較する
+				output := filepath.Join(dir, tt.name+".png")
+				require.NoError(t, tt.drawer(output).Draw())
+				assertGolden(t, tt.name, decodePNG(t, output))
+				return
+			}
+
+			output := filepath.Join(dir, tt.name+".gif")
+			require.NoError(t, tt.drawer(output).Draw())
+			f, err := os.Open(output)
+			require.NoError(t, err)
+			defer f.Close()
+			g, err := gif.DecodeAll(f)
+			require.NoError(t, err)
+			for i, frame := range g.Image {
+				assertGolden(t, fmt.Sprintf("%s_frame%d", tt.name, i), frame)
+			}
+		})
+	}
+}
+
+func mustParseFill(t *testing.T, s string) *Fill {
+	t.Helper()
+
+	f, err := ParseFill(s)
+	require.NoError(t, err)
+	return f
+}
+
+func TestCompareImages(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			base.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), 128, 0xff})
+		}
+	}
+
+	same := compareImages(base, base)
+	assert.Equal(t, 0, same.mismatched)
+	assert.InDelta(t, 1.0, same.ssim, 1e-9)
+	assert.True(t, same.ok())
+
+	// 許容範囲内のわずかな差は一致とみなす
+	noisy := image.NewRGBA(base.Rect)
+	draw.Draw(noisy, noisy.Rect, base, image.Point{}, draw.Src)
+	for i := 0; i < len(noisy.Pix); i += 4 {
+		noisy.Pix[i] = uint8(min(int(noisy.Pix[i])+4, 255))
+	}
+	assert.True(t, compareImages(base, noisy).ok())
+
+	// 一部が塗りつぶされると一致しない
+	changed := image.NewRGBA(base.Rect)
+	draw.Draw(changed, changed.Rect, base, image.Point{}, draw.Src)
+	draw.Draw(changed, image.Rect(8, 8, 24, 24), image.White, image.Point{}, draw.Src)
+	diff := compareImages(base, changed)
+	assert.Equal(t, 16*16, diff.mismatched)
+	assert.Less(t, diff.ssim, minSSIM)
+	assert.False(t, diff.ok())
+	assert.Equal(t, color.RGBA{0xff, 0, 0, 0xff}, diff.diff.At(10, 10))
+}
+
+// assertGolden は描画結果をtestdata/golden/<name>.pngと比較する
+// -updateが指定されていれば参照画像を書き換える
+func assertGolden(t *testing.T, name string, got image.Image) {
+	t.Helper()
+
+	path := filepath.Join(goldenDir, name+".png")
+	if *update {
+		require.NoError(t, os.MkdirAll(goldenDir, 0o755))
+		writePNG(t, path, got)
+		return
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		t.Fatalf("golden image %s does not exist; run go test -run TestGolden -update", path)
+	}
+	want := decodePNG(t, path)
+	if !want.Bounds().Eq(got.Bounds()) {
+		t.Fatalf("%s: bounds %v, want %v", name, got.Bounds(), want.Bounds())
+	}
+
+	result := compareImages(want, got)
+	if result.ok() {
+		return
+	}
+
+	require.NoError(t, os.MkdirAll(goldenFailureDir, 0o755))
+	actualPath := filepath.Join(goldenFailureDir, name+".actual.png")
+	diffPath := filepath.Join(goldenFailureDir, name+".diff.png")
+	writePNG(t, actualPath, got)
+	writePNG(t, diffPath, result.diff)
+	t.Errorf("%s differs from %s: %d/%d pixels (%.3f%%) over tolerance, max delta %d, SSIM %.4f (min %.2f)\nactual: %s\ndiff:   %s",
+		name, path, result.mismatched, result.total, result.mismatchRatio()*100, result.maxDelta, result.ssim, minSSIM, actualPath, diffPath)
+}
+
+// comparison は2枚の画像の比較結果
+type comparison struct {
+	total      int
+	mismatched int     // チャンネルの差がpixelToleranceを超えたピクセル数
+	maxDelta   int     // チャンネルの差の最大値
+	ssim       float64 // 輝度の平均SSIM
+	diff       *image.RGBA
+}
+
+func (c *comparison) mismatchRatio() float64 {
+	return float64(c.mismatched) / float64(c.total)
+}
+
+func (c *comparison) ok() bool {
+	return c.mismatchRatio() <= maxMismatchRatio && c.ssim >= minSSIM
+}
+
+// compareImages はピクセルごとの差とSSIMを計算し、差分画像を作る
+// 差分画像では一致しないピクセルを赤、それ以外を薄いグレーで表す
+func compareImages(want, got image.Image) *comparison {
+	bounds := want.Bounds()
+	c := &comparison{
+		total: bounds.Dx() * bounds.Dy(),
+		diff:  image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy())),
+	}
+
+	wantLuma := make([]float64, c.total)
+	gotLuma := make([]float64, c.total)
+	offset := got.Bounds().Min.Sub(bounds.Min)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+			g := color.NRGBAModel.Convert(got.At(x+offset.X, y+offset.Y)).(color.NRGBA)
+
+			delta := max(absDiff(w.R, g.R), absDiff(w.G, g.G), absDiff(w.B, g.B), absDiff(w.A, g.A))
+			c.maxDelta = max(c.maxDelta, delta)
+
+			dx, dy := x-bounds.Min.X, y-bounds.Min.Y
+			i := dy*bounds.Dx() + dx
+			wantLuma[i] = luma(w)
+			gotLuma[i] = luma(g)
+			if delta > pixelTolerance {
+				c.mismatched++
+				c.diff.Set(dx, dy, color.RGBA{0xff, 0, 0, 0xff})
+			} else {
+				v := uint8(192 + wantLuma[i]/4)
+				c.diff.Set(dx, dy, color.RGBA{v, v, v, 0xff})
+			}
+		}
+	}
+	c.ssim = ssim(wantLuma, gotLuma, bounds.Dx(), bounds.Dy())
+	return c
+}
+
+func absDiff(a, b uint8) int {
+	return int(math.Abs(float64(a) - float64(b)))
+}
+
+func luma(c color.NRGBA) float64 {
+	return 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+}
+
+// ssim は8x8のウィンドウごとに計算した輝度のSSIMの平均を返す
+func ssim(a, b []float64, width, height int) float64 {
+	const (
+		window = 8
+		c1     = (0.01 * 255) * (0.01 * 255)
+		c2     = (0.03 * 255) * (0.03 * 255)
+	)
+
+	total, count := 0.0, 0
+	for y0 := 0; y0 < height; y0 += window {
+		for x0 := 0; x0 < width; x0 += window {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			n := 0.0
+			for y := y0; y < min(y0+window, height); y++ {
+				for x := x0; x < min(x0+window, width); x++ {
+					va, vb := a[y*width+x], b[y*width+x]
+					sumA += va
+					sumB += vb
+					sumAA += va * va
+					sumBB += vb * vb
+					sumAB += va * vb
+					n++
+				}
+			}
+			meanA, meanB := sumA/n, sumB/n
+			varA := sumAA/n - meanA*meanA
+			varB := sumBB/n - meanB*meanB
+			cov := sumAB/n - meanA*meanB
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) / ((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			count++
+		}
+	}
+	return total / float64(count)
+}
+
+func decodePNG(t *testing.T, path string) image.Image {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err, path)
+	return img
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, png.Encode(f, img), strings.TrimSuffix(path, ".png"))
+}
@@ -1,145 +1,118 @@
 package lgtm
 
 import (
-	"fmt"
+	"context"
 	"image"
-	"image/draw"
-	"image/gif"
-	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/disintegration/imaging"
+	"github.com/fogleman/gg"
 )
 
 type GopherDrawer struct {
 	InputPath  string
 	OutputPath string
+	Workers    int    // number of goroutines rendering GIF frames (GOMAXPROCS if <= 0)
+	Limits     Limits // limits checked against the input header before decoding
 }
 
 func NewGopherDrawer(inputPath, outputPath string) Drawer {
-	return &GopherDrawer{InputPath: inputPath, OutputPath: outputPath}
+	return &GopherDrawer{InputPath: inputPath, OutputPath: outputPath, Limits: DefaultLimits}
 }
 
 func (t *GopherDrawer) Draw() error {
-	ext, err := t.extension(t.InputPath)
-	if err != nil {
-		return err
-	}
-
-	if ext == "gif" {
-		return t.drawOnGIF(t.InputPath, t.OutputPath)
-	}
-	return t.drawOnImage(t.InputPath, t.OutputPath, ext)
+	return t.DrawContext(context.Background())
 }
 
-func (t *GopherDrawer) extension(path string) (string, error) {
-	f, err := os.Open(path)
+func (t *GopherDrawer) DrawContext(ctx context.Context) error {
+	ext, err := inspect(t.InputPath, t.Limits)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	_, format, err := image.DecodeConfig(f)
-	if err != nil {
-		return "", err
+	if ext == "gif" {
+		return t.drawOnGIF(ctx, t.InputPath, t.OutputPath)
 	}
-
-	return format, nil
+	return t.drawOnImage(ctx, t.InputPath, t.OutputPath, ext)
 }
 
 func (t *GopherDrawer) newFilename(inputPath, outputPath, ext string) string {
 	if outputPath != "" {
 		return outputPath
 	}
-	filename := filepath.Base(inputPath)
-	name := strings.Split(filename, ".")[0]
-	suffix := "gopher"
-	return filepath.Join(".", fmt.Sprintf("%s-%s.%s", name, suffix, ext))
+	return DefaultOutputPath(inputPath, "gopher", ext)
 }
 
-func (t *GopherDrawer) drawOnGIF(inputPath, outputPath string) error {
-	file, err := os.Open(inputPath)
+func (t *GopherDrawer) drawOnGIF(ctx context.Context, inputPath, outputPath string) error {
+	orgGif, err := openGIF(inputPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	orgGif, err := gif.DecodeAll(file)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	newImage := make([]*image.Paletted, 0, len(orgGif.Image))
-	for i, v := range orgGif.Image {
-		v := v
-		var img image.Image
-		img, err = t.embedGopher(v, i%2 == 0)
-		if err != nil {
-			return err
-		}
-		palettedImage := &image.Paletted{
-			Pix:     v.Pix,
-			Stride:  v.Stride,
-			Rect:    v.Bounds(),
-			Palette: v.Palette,
-		}
-		draw.Draw(palettedImage, palettedImage.Rect, img, img.Bounds().Min, draw.Over)
-		newImage = append(newImage, palettedImage)
-	}
-	orgGif.Image = newImage
-
-	out, err := os.Create(t.newFilename(inputPath, outputPath, "gif"))
+	gopher, err := t.gopher(gifScreen(orgGif))
 	if err != nil {
-		return err
+		return newError(StageRender, inputPath, nil, err)
+	}
+	err = drawFrames(ctx, orgGif, t.Workers, func() (frameRenderer, error) {
+		return func(dc *gg.Context, i int) error {
+			t.embedGopher(dc, gopher, i%2 == 0)
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return newError(StageRender, inputPath, nil, err)
 	}
-	defer out.Close()
 
-	if err := gif.EncodeAll(out, orgGif); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	return nil
+	return saveGIF(orgGif, inputPath, t.newFilename(inputPath, outputPath, "gif"))
 }
 
-func (t *GopherDrawer) drawOnImage(inputPath, outputPath, ext string) error {
-	img, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
+func (t *GopherDrawer) drawOnImage(ctx context.Context, inputPath, outputPath, ext string) error {
+	img, err := openImage(inputPath)
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	img, err = t.embedGopher(img, false)
+	gopher, err := t.gopher(img.Bounds())
 	if err != nil {
-		return err
+		return newError(StageRender, inputPath, nil, err)
 	}
+	dc := newCanvas(img)
+	t.embedGopher(dc, gopher, false)
 
-	if err := imaging.Save(img, t.newFilename(inputPath, outputPath, ext)); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	return nil
+	return saveImage(dc.Image(), inputPath, t.newFilename(inputPath, outputPath, ext))
 }
 
-func (t *GopherDrawer) embedGopher(src image.Image, shake bool) (image.Image, error) {
+// gopher returns the gopher image sized to fit on the canvas.
+func (t *GopherDrawer) gopher(canvas image.Rectangle) (image.Image, error) {
 	gopher, err := GopherPng.Image()
 	if err != nil {
 		return nil, err
 	}
 
 	// if gopher image is larger than src image, resize gopher image to half size.
-	if src.Bounds().Dx() <= gopher.Bounds().Dx() || src.Bounds().Dy() <= gopher.Bounds().Dy() {
+	if canvas.Dx() <= gopher.Bounds().Dx() || canvas.Dy() <= gopher.Bounds().Dy() {
 		gopher = imaging.Resize(gopher, gopher.Bounds().Dx()/2, gopher.Bounds().Dy()/2, imaging.NearestNeighbor)
 	}
+	return gopher, nil
+}
 
-	x := -((src.Bounds().Dx() - gopher.Bounds().Dx()) / 2)
-	y := -(src.Bounds().Dy() - gopher.Bounds().Dy()) / 2
+func (t *GopherDrawer) embedGopher(dc *gg.Context, gopher image.Image, shake bool) {
+	x := (dc.Width() - gopher.Bounds().Dx()) / 2
+	y := (dc.Height() - gopher.Bounds().Dy()) / 2
 	if shake {
-		x -= 3
+		x += 3
 	}
 
-	center := image.Point{x, y}
-	newImg := image.NewRGBA(src.Bounds())
-	draw.Draw(newImg, newImg.Bounds(), src, image.Point{0, 0}, draw.Src)
-	draw.Draw(newImg, newImg.Bounds(), gopher, center, draw.Over)
-
-	return newImg, nil
+	dc.DrawImage(gopher, x, y)
 }
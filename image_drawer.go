@@ -1,18 +1,12 @@
 package lgtm
 
 import (
+	"context"
 	_ "embed"
-	"fmt"
 	"image"
-	"image/draw"
-	"image/gif"
-	"os"
-	"path/filepath"
-	"strings"
 
-	"github.com/disintegration/imaging"
 	"github.com/fogleman/gg"
-	"github.com/pkg/errors"
+	"golang.org/x/image/font"
 )
 
 type TextDrawer struct {
@@ -20,6 +14,9 @@ type TextDrawer struct {
 	SubText    *Text
 	InputPath  string
 	OutputPath string
+	Workers    int    // GIFのフレームを並列に描画するゴルーチン数（0以下ならGOMAXPROCS）
+	Limits     Limits // デコード前に検査する入力画像の上限
+	Layout     LayoutOptions
 }
 
 func NewTextDrawer(main, sub *Text, inputPath, outputPath string) Drawer {
@@ -28,144 +25,148 @@ func NewTextDrawer(main, sub *Text, inputPath, outputPath string) Drawer {
 		SubText:    sub,
 		InputPath:  inputPath,
 		OutputPath: outputPath,
+		Limits:     DefaultLimits,
 	}
 }
 
 func (t *TextDrawer) Draw() error {
-	ext, err := t.extension(t.InputPath)
-	if err != nil {
-		return err
-	}
-
-	if ext == "gif" {
-		return t.drawOnGIF(t.InputPath, t.OutputPath)
-	}
-	return t.drawOnImage(t.InputPath, t.OutputPath, ext)
+	return t.DrawContext(context.Background())
 }
 
-func (t *TextDrawer) extension(path string) (string, error) {
-	f, err := os.Open(path)
+func (t *TextDrawer) DrawContext(ctx context.Context) error {
+	ext, err := inspect(t.InputPath, t.Limits)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	_, format, err := image.DecodeConfig(f)
-	if err != nil {
-		return "", err
+	if ext == "gif" {
+		return t.drawOnGIF(ctx, t.InputPath, t.OutputPath)
 	}
-
-	return format, nil
+	return t.drawOnImage(ctx, t.InputPath, t.OutputPath, ext)
 }
 
 func (t *TextDrawer) newFilename(inputPath, outputPath, ext string) string {
 	if outputPath != "" {
 		return outputPath
 	}
-	filename := filepath.Base(inputPath)
-	name := strings.Split(filename, ".")[0]
-	suffix := "lgtm"
-	return filepath.Join(".", fmt.Sprintf("%s-%s.%s", name, suffix, ext))
+	return DefaultOutputPath(inputPath, "lgtm", ext)
 }
 
-func (t *TextDrawer) drawOnGIF(inputPath, outputPath string) error {
-	file, err := os.Open(inputPath)
+func (t *TextDrawer) drawOnGIF(ctx context.Context, inputPath, outputPath string) error {
+	orgGif, err := openGIF(inputPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	orgGif, err := gif.DecodeAll(file)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	newImage := make([]*image.Paletted, 0, len(orgGif.Image))
-	for _, v := range orgGif.Image {
-		v := v
-		var img image.Image
-		img, err = t.embedTexts(v)
-		if err != nil {
-			return err
-		}
-
-		palettedImage := &image.Paletted{
-			Pix:     v.Pix,
-			Stride:  v.Stride,
-			Rect:    v.Bounds(),
-			Palette: v.Palette,
-		}
-		draw.Draw(palettedImage, palettedImage.Rect, img, img.Bounds().Min, draw.Over)
-		newImage = append(newImage, palettedImage)
+	// 全フレームが同じ論理スクリーンを共有するため、レイアウトは一度だけ計算する
+	layout, err := t.layout(ctx, gifScreen(orgGif))
+	if err != nil {
+		return newError(StageLayout, inputPath, nil, err)
 	}
-	orgGif.Image = newImage
-
-	out, err := os.Create(t.newFilename(inputPath, outputPath, "gif"))
+	err = drawFrames(ctx, orgGif, t.Workers, func() (frameRenderer, error) {
+		return t.renderer(layout)
+	})
 	if err != nil {
-		return err
+		return newError(StageRender, inputPath, nil, err)
 	}
-	defer out.Close()
 
-	if err := gif.EncodeAll(out, orgGif); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	return nil
+	return saveGIF(orgGif, inputPath, t.newFilename(inputPath, outputPath, "gif"))
 }
 
-func (t *TextDrawer) drawOnImage(inputPath, outputPath, ext string) error {
-	img, err := imaging.Open(inputPath, imaging.AutoOrientation(true))
+func (t *TextDrawer) drawOnImage(ctx context.Context, inputPath, outputPath, ext string) error {
+	img, err := openImage(inputPath)
 	if err != nil {
 		return err
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	img, err = t.embedTexts(img)
+	layout, err := t.layout(ctx, img.Bounds())
 	if err != nil {
-		return err
+		return newError(StageLayout, inputPath, nil, err)
+	}
+	render, err := t.renderer(layout)
+	if err != nil {
+		return newError(StageLayout, inputPath, nil, err)
+	}
+	dc := newCanvas(img)
+	if err := render(dc, 0); err != nil {
+		return newError(StageRender, inputPath, nil, err)
 	}
 
-	if err := imaging.Save(img, t.newFilename(inputPath, outputPath, ext)); err != nil {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	return nil
+	return saveImage(dc.Image(), inputPath, t.newFilename(inputPath, outputPath, ext))
 }
 
-func (t *TextDrawer) embedTexts(i image.Image) (image.Image, error) {
-	img, err := t.embedString(i, t.MainText)
-	if err != nil {
-		return nil, err
-	}
-
-	// サブテキストが空でない場合のみ描画
-	if t.SubText.Text.String() != "" {
-		img, err = t.embedString(img, t.SubText)
-		if err != nil {
+// layout はキャンバスの大きさからメインテキストとサブテキストのレイアウトを計算する
+// GIFでは全フレームでこの結果を使い回す
+func (t *TextDrawer) layout(ctx context.Context, canvas image.Rectangle) (*LayoutResult, error) {
+	for _, text := range []*Text{t.MainText, t.SubText} {
+		if text == nil {
+			continue
+		}
+		if text.Background != nil {
+			if err := text.Background.validate(); err != nil {
+				return nil, err
+			}
+		}
+		if text.Fill != nil {
+			if err := text.Fill.validate(); err != nil {
+				return nil, err
+			}
+		}
+		if err := text.validateTransform(); err != nil {
+			return nil, err
+		}
+		if err := text.validateWritingMode(); err != nil {
 			return nil, err
 		}
 	}
-
-	return img, nil
+	return layoutTexts(ctx, canvas, t.MainText, t.SubText, t.Layout)
 }
 
-func (t *TextDrawer) embedString(img image.Image, text *Text) (image.Image, error) {
-	imgWidth := img.Bounds().Dx()
-	imgHeight := img.Bounds().Dy()
-	dc := gg.NewContext(imgWidth, imgHeight)
-	dc.DrawImage(img, 0, 0)
-
-	fontSize := text.FontSize(img)
-	face, err := text.Font.FontFace(fontSize)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to parse font %s", err.Error())
+// renderer は計算済みのレイアウトでテキストを描画するframeRendererを作成する
+// font.Faceはゴルーチン間で共有できないため、呼び出しごとに生成する
+func (t *TextDrawer) renderer(layout *LayoutResult) (frameRenderer, error) {
+	boxes := layout.Boxes()
+	faces := make([]font.Face, 0, len(boxes))
+	fills := make([]*filledText, len(boxes))
+	for i, b := range boxes {
+		face, err := b.Text.Font.FontFace(b.FontSize)
+		if err != nil {
+			return nil, &Error{Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+		}
+		faces = append(faces, face)
+		if b.Text.Fill != nil {
+			fills[i] = newFilledText(b, face)
+		}
 	}
-	dc.SetFontFace(face)
-
-	dc.SetColor(text.TextColor.Gray16())
-
-	pt := text.Point(img)
-	// 1行制限: DrawStringAnchoredを使用して改行を防ぐ
-	// 中央揃えで描画（0.5, 0.5 = 中央基準点）
-	dc.DrawStringAnchored(text.Text.String(), pt.X, pt.Y, 0.5, 0.5)
 
-	return dc.Image(), nil
+	return func(dc *gg.Context, _ int) error {
+		// サブテキストの背景がメインテキストに重ならないよう、背景を先にすべて描画する
+		for _, b := range boxes {
+			if b.Text.Background != nil {
+				b.Text.Background.draw(dc, b)
+			}
+		}
+		for i, b := range boxes {
+			if fills[i] != nil {
+				fills[i].draw(dc)
+				continue
+			}
+			dc.SetFontFace(faces[i])
+			dc.SetColor(b.Text.TextColor.Gray16())
+			b.draw(dc, 0, 0)
+		}
+		return nil
+	}, nil
 }
@@ -0,0 +1,89 @@
+package lgtm
+
+import (
+	"context"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// ImpactBurstDrawer はギザギザの爆発の吹き出しと、その周りに飛び散る衝撃の線を描く
+// 吹き出しは画像と同じ縦横比の楕円に沿わせ、中にテキストを書けるよう塗りつぶす
+type ImpactBurstDrawer struct {
+	InputPath  string
+	OutputPath string
+	FillColor  color.Color // 吹き出しの中の色
+	LineColor  color.Color // 吹き出しの枠線と衝撃の線の色
+	Size       float64     // 画像の幅・高さに対する吹き出しの付け根の大きさ（0なら0.7）
+	Spikes     int         // 吹き出しのトゲの数
+	Focus      *Point      // 吹き出しの中心（nilなら画像の中心）
+	Seed       int64       // トゲの形の乱数シード（0なら描画のたびに変わる）
+	Workers    int         // ConcentrationLinesDrawer.Workersと同じ
+	Limits     Limits      // ConcentrationLinesDrawer.Limitsと同じ
+}
+
+func NewImpactBurstDrawer(inputPath, outputPath string) Drawer {
+	return &ImpactBurstDrawer{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		FillColor:  color.White,
+		LineColor:  color.Black,
+		Spikes:     18,
+		Limits:     DefaultLimits,
+	}
+}
+
+func (b *ImpactBurstDrawer) Draw() error {
+	return b.DrawContext(context.Background())
+}
+
+func (b *ImpactBurstDrawer) DrawContext(ctx context.Context) error {
+	return drawEffect(ctx, b.InputPath, b.OutputPath, "burst", b.Workers, b.Limits, b.Focus, b.drawImpactBurst)
+}
+
+// drawImpactBurst はトゲの先端と付け根を交互につないだ多角形を塗って縁取り、トゲの外側に短い線を描く
+func (b *ImpactBurstDrawer) drawImpactBurst(dc *gg.Context, index int, focus Point) {
+	spikes := max(b.Spikes, 3)
+	size := b.Size
+	if size <= 0 {
+		size = 0.7
+	}
+	// 吹き出しの付け根が沿う楕円の半径
+	rx, ry := float64(dc.Width())*size/2, float64(dc.Height())*size/2
+	stroke := math.Max(math.Min(float64(dc.Width()), float64(dc.Height()))*0.008, 1)
+
+	rng := frameRand(b.Seed, index)
+
+	step := math.Pi / float64(spikes)
+	point := func(angle, scale float64) (float64, float64) {
+		return focus.X + math.Cos(angle)*rx*scale, focus.Y + math.Sin(angle)*ry*scale
+	}
+	tips := make([]float64, spikes)
+	dc.NewSubPath()
+	for i := 0; i < spikes*2; i++ {
+		angle := float64(i)*step + (rng.Float64()-0.5)*step*0.6
+		scale := 0.88 + rng.Float64()*0.08 // 付け根
+		if i%2 == 0 {
+			scale = 1.12 + rng.Float64()*0.2 // 先端
+			tips[i/2] = angle
+		}
+		dc.LineTo(point(angle, scale))
+	}
+	dc.ClosePath()
+	dc.SetColor(b.FillColor)
+	dc.FillPreserve()
+	dc.SetColor(b.LineColor)
+	dc.SetLineWidth(stroke)
+	dc.SetLineJoin(gg.LineJoinRound)
+	dc.Stroke()
+
+	// トゲの先端の外側に衝撃の線を描く
+	for _, angle := range tips {
+		start := 1.38 + rng.Float64()*0.06
+		x1, y1 := point(angle, start)
+		x2, y2 := point(angle, start+0.12+rng.Float64()*0.08)
+		dc.DrawLine(x1, y1, x2, y2)
+		dc.Stroke()
+	}
+}
@@ -0,0 +1,41 @@
+package lgtm
+
+import (
+	"bufio"
+	"os"
+)
+
+// ImageInfo はデコードせずにヘッダから読み取った画像ファイルの情報
+type ImageInfo struct {
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Frames int    `json:"frames"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// Describe は画像ファイルのフォーマット・大きさ・フレーム数・バイト数を返す
+func Describe(path string) (*ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, newError(StageInspect, path, nil, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, newError(StageInspect, path, nil, err)
+	}
+
+	header, err := readHeader(bufio.NewReader(f), Limits{})
+	if err != nil {
+		return nil, newError(StageInspect, path, ErrDecode, err)
+	}
+	return &ImageInfo{
+		Format: header.Format,
+		Width:  header.Width,
+		Height: header.Height,
+		Frames: header.Frames,
+		Bytes:  stat.Size(),
+	}, nil
+}
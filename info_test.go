@@ -0,0 +1,53 @@
+package lgtm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	tmpDir := t.TempDir()
+	gifPath := filepath.Join(tmpDir, "anim.gif")
+	writeTestGIF(t, gifPath, 3, 120, 80)
+
+	tests := []struct {
+		name   string
+		path   string
+		format string
+		width  int
+		height int
+		frames int
+	}{
+		{name: "jpeg", path: "testdata/images/test_rect_400x300.jpg", format: "jpeg", width: 400, height: 300, frames: 1},
+		{name: "gif", path: gifPath, format: "gif", width: 120, height: 80, frames: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Describe(tt.path)
+			require.NoError(t, err)
+
+			stat, err := os.Stat(tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, &ImageInfo{
+				Format: tt.format,
+				Width:  tt.width,
+				Height: tt.height,
+				Frames: tt.frames,
+				Bytes:  stat.Size(),
+			}, info)
+		})
+	}
+
+	_, err := Describe(filepath.Join(tmpDir, "missing.jpg"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDefaultOutputPath(t *testing.T) {
+	assert.Equal(t, "cat-lgtm.jpeg", DefaultOutputPath("/tmp/images/cat.jpg", "lgtm", "jpeg"))
+	assert.Equal(t, "anim-gopher.gif", DefaultOutputPath("anim.gif", "gopher", "gif"))
+}
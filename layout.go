@@ -0,0 +1,451 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+	"github.com/pkg/errors"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextBox はレイアウト済みのテキスト1つ分の情報
+// 座標はキャンバスの左上を原点とする
+type TextBox struct {
+	Text     *Text
+	FontSize float64         // フォントサイズ（ポイント）
+	Point    Point           // 描画されるグリフの中心
+	Baseline Point           // DrawStringで描画を始めるベースライン上の点
+	Width    float64         // カーニングを含む文字列の送り幅
+	Ascent   float64         // フォントのベースラインから上端までの高さ
+	Descent  float64         // フォントのベースラインから下端までの高さ
+	Bounds   image.Rectangle // 描画されるグリフのバウンディングボックス（回転・円弧の場合は回転後の範囲）
+
+	glyphs   []placedGlyph // 回転・円弧・縦書きの場合の1文字ずつの配置
+	vertical bool          // 縦書きで描くかどうか
+}
+
+// LayoutResult はメインテキストとサブテキストのレイアウト
+type LayoutResult struct {
+	Main *TextBox
+	Sub  *TextBox // サブテキストが空の場合はnil
+}
+
+// Boxes は描画する順にテキストボックスを返す
+func (r *LayoutResult) Boxes() []*TextBox {
+	if r.Sub == nil {
+		return []*TextBox{r.Main}
+	}
+	return []*TextBox{r.Main, r.Sub}
+}
+
+// LayoutOptions はレイアウトの調整項目
+// 0の項目はデフォルト値を使う
+// フォントサイズはポイントで指定する（1ポイントは96/72ピクセル）
+// フォントサイズを指定しても、画像に収まらない場合は縮小する
+type LayoutOptions struct {
+	Margin int // テキストと画像の端の最小距離（デフォルトは0）
+	Gap    int // メインテキストとサブテキストの最小間隔（デフォルトは画像の高さの1%、最小1px）
+
+	Size       float64 // メインテキストのフォントサイズ（デフォルトは画像に合わせて決める）
+	SubSize    float64 // サブテキストのフォントサイズ（デフォルトはSubRatioまたは画像に合わせて決める）
+	SubRatio   float64 // メインテキストに対するサブテキストのフォントサイズの比率（SubSizeを指定した場合は使わない）
+	MaxSize    float64 // メインテキストのフォントサイズの上限（デフォルトは上限なし）
+	MaxSubSize float64 // サブテキストのフォントサイズの上限（デフォルトは画像に合わせて決める場合のみメインテキストと同じ大きさ）
+
+	Saliency *SaliencyMap // 画像の重要度（指定した場合はテキストを重要度の低い範囲に動かす）
+}
+
+// validate は負のサイズや比率を検査する
+func (o LayoutOptions) validate() error {
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"Size", o.Size}, {"SubSize", o.SubSize}, {"SubRatio", o.SubRatio}, {"MaxSize", o.MaxSize}, {"MaxSubSize", o.MaxSubSize},
+	}
+	for _, v := range values {
+		if v.value < 0 || math.IsNaN(v.value) || math.IsInf(v.value, 0) {
+			return errors.Errorf("invalid layout options: %s %v must be a non-negative number", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+// fontSizes はオプションに従ってメインテキストとサブテキストのフォントサイズを決める
+// 縦書きの場合は画像の高さに合わせて決める
+func (o LayoutOptions) fontSizes(canvas image.Rectangle, main, sub *Text, vertical bool) (float64, float64) {
+	autoSize := func(t *Text) float64 {
+		if vertical {
+			return t.verticalFontSize(canvas)
+		}
+		return t.fontSize(canvas)
+	}
+	mainSize := o.Size
+	if mainSize == 0 {
+		mainSize = autoSize(main)
+	}
+	if o.MaxSize > 0 {
+		mainSize = math.Min(mainSize, o.MaxSize)
+	}
+	if sub == nil {
+		return mainSize, 0
+	}
+
+	subSize, maxSubSize := o.SubSize, o.MaxSubSize
+	switch {
+	case subSize > 0:
+	case o.SubRatio > 0:
+		subSize = mainSize * o.SubRatio
+	default:
+		subSize = autoSize(sub)
+		// 短いサブテキストがメインテキストより大きくならないようにする
+		if maxSubSize == 0 {
+			maxSubSize = mainSize
+		}
+	}
+	if maxSubSize > 0 {
+		subSize = math.Min(subSize, maxSubSize)
+	}
+	return mainSize, subSize
+}
+
+// Layout はキャンバスの大きさからメインテキストとサブテキストのフォントサイズと位置を計算する
+// テキストは画像（マージンを除く）からはみ出さず、メインテキストとサブテキストは重ならない
+// 中央揃えは送り幅ではなく実際に描かれるグリフのバウンディングボックスで行う
+// フォントサイズは指定がなければ画像に合わせて決め、サブテキストはメインテキストとの比率や上限でも決められる
+// TextDrawerは返したベースラインにそのまま描画する
+// subがnilまたは空文字列の場合はメインテキストだけをレイアウトする
+func Layout(bounds image.Rectangle, main, sub *Text, opts LayoutOptions) (*LayoutResult, error) {
+	return layoutTexts(context.Background(), bounds, main, sub, opts)
+}
+
+func layoutTexts(ctx context.Context, canvas image.Rectangle, main, sub *Text, opts LayoutOptions) (*LayoutResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	// サブテキストが空でない場合のみ描画
+	if sub != nil && sub.Text.String() == "" {
+		sub = nil
+	}
+
+	// フォントサイズの二分探索は重いため、前後でキャンセルを確認する
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// サブテキストもメインテキストと同じ書字方向で描く
+	vertical := main.vertical(canvas)
+	mainSize, subSize := opts.fontSizes(canvas, main, sub, vertical)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var mainPoint, subPoint Point
+	if vertical {
+		mainPoint, subPoint = verticalPoints(canvas, mainSize, subSize, sub != nil)
+	} else {
+		mainPoint = *main.point(canvas, mainSize)
+		if sub != nil {
+			subPoint = *sub.point(canvas, subSize)
+		}
+	}
+
+	r := &LayoutResult{}
+	var err error
+	if r.Main, err = newTextBox(main, mainSize, mainPoint, vertical); err != nil {
+		return nil, err
+	}
+	if sub != nil {
+		if r.Sub, err = newTextBox(sub, subSize, subPoint, vertical); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.fit(canvas, opts); err != nil {
+		return nil, err
+	}
+	if opts.Saliency != nil {
+		if err := r.place(canvas, opts); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func newTextBox(text *Text, fontSize float64, point Point, vertical bool) (*TextBox, error) {
+	b := &TextBox{Text: text, Point: point, vertical: vertical}
+	if err := b.resize(fontSize); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// resize はフォントサイズを変えて寸法とバウンディングボックスを計算し直す
+func (b *TextBox) resize(fontSize float64) error {
+	face, err := b.Text.Font.FontFace(fontSize)
+	if err != nil {
+		return &Error{Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+	}
+	defer face.Close()
+
+	s := b.Text.Text.String()
+	metrics := face.Metrics()
+	// カーニングを含む送り幅と、原点から描画したときのグリフの範囲
+	ink, advance := font.BoundString(face, s)
+
+	b.FontSize = fontSize
+	b.Width = float64(advance) / 64
+	b.Ascent = float64(metrics.Ascent) / 64
+	b.Descent = float64(metrics.Descent) / 64
+	if b.vertical || b.Text.transformed() || b.Text.shaped() || b.Text.hasEmoji() {
+		// 回転・円弧・縦書き・シェーピング・絵文字の場合は1文字ずつ配置し、回転後のグリフの範囲をバウンディングボックスにする
+		glyphs, ink, err := placeGlyphs(face, b.Text, b.vertical, fontSize*fontDPI/72)
+		if err != nil {
+			return err
+		}
+		b.glyphs = glyphs
+		b.Baseline = b.Point
+		if len(glyphs) > 0 {
+			b.Baseline = Point{X: b.Point.X + glyphs[0].x, Y: b.Point.Y + glyphs[0].y}
+		}
+		b.Bounds = ink.pixels(b.Point.X, b.Point.Y)
+		return nil
+	}
+	if ink.Empty() {
+		// 空白だけのテキストは送り幅と行の高さで中央に揃える
+		b.Baseline = Point{X: b.Point.X - b.Width/2, Y: b.Point.Y + float64(metrics.Height)/64/2}
+	} else {
+		// 実際に描画されるグリフの中心をPointに合わせる
+		b.Baseline = Point{
+			X: b.Point.X - float64(ink.Min.X+ink.Max.X)/64/2,
+			Y: b.Point.Y - float64(ink.Min.Y+ink.Max.Y)/64/2,
+		}
+	}
+	b.Bounds = glyphBounds(face, s, b.Baseline)
+	return nil
+}
+
+// draw はテキストを(dx, dy)だけずらして描画する
+// フォントはあらかじめdcに設定しておく
+func (b *TextBox) draw(dc *gg.Context, dx, dy float64) {
+	if b.glyphs != nil {
+		drawGlyphs(dc, b.glyphs, b.Point.X+dx, b.Point.Y+dy)
+		return
+	}
+	// 1行制限: DrawStringを使用して改行を防ぐ
+	// レイアウトで計算したベースラインから描画し、Boundsと実際の描画位置を一致させる
+	dc.DrawString(b.Text.Text.String(), b.Baseline.X+dx, b.Baseline.Y+dy)
+}
+
+// move は基準点を整数ピクセルだけ動かす
+func (b *TextBox) move(dx, dy int) {
+	b.Point.X += float64(dx)
+	b.Point.Y += float64(dy)
+	b.Baseline.X += float64(dx)
+	b.Baseline.Y += float64(dy)
+	b.Bounds = b.Bounds.Add(image.Pt(dx, dy))
+}
+
+// glyphBounds はベースライン上の点から描画した文字列のグリフの範囲を返す
+func glyphBounds(face font.Face, s string, baseline Point) image.Rectangle {
+	// ggと同じく小数点以下は26.6の固定小数点に切り捨てる
+	d := &font.Drawer{
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(baseline.X * 64), Y: fixed.Int26_6(baseline.Y * 64)},
+	}
+	bounds, _ := d.BoundString(s)
+	return image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil())
+}
+
+// maxFitIterations は fit でフォントサイズを縮める最大回数
+const maxFitIterations = 32
+
+// fit はキャンバスからはみ出すテキストを縮小・移動し、メインテキストとサブテキストが重なる場合はサブテキストを下にずらす
+// FontSize・Pointの計算で収まっている場合は何もしない
+// maxFitIterations回で収まらない場合はErrTextOverflowを返す
+func (r *LayoutResult) fit(canvas image.Rectangle, opts LayoutOptions) error {
+	area := opts.area(canvas)
+	width, height := area.Dx(), area.Dy()
+	gap := opts.Gap
+	if gap <= 0 {
+		gap = max(1, canvas.Dy()/100)
+	}
+
+	for i := 0; i < maxFitIterations; i++ {
+		// 1. キャンバスより大きいテキストを縮小する
+		resized := false
+		for _, b := range r.Boxes() {
+			dx, dy := b.Bounds.Dx(), b.Bounds.Dy()
+			if dx <= width && dy <= height {
+				continue
+			}
+			scale := math.Min(float64(width)/float64(dx), float64(height)/float64(dy))
+			if err := b.resize(b.FontSize * scale * 0.95); err != nil {
+				return err
+			}
+			resized = true
+		}
+		if resized {
+			continue
+		}
+
+		// 2. 左右にはみ出すテキストを内側に移動する
+		for _, b := range r.Boxes() {
+			b.move(shiftInto(b.Bounds.Min.X, b.Bounds.Max.X, area.Min.X, area.Max.X), 0)
+		}
+
+		// 縦書きの場合は列ごとに上下に収め、サブテキストをメインテキストの左に並べる
+		if r.Main.vertical {
+			done, err := r.fitColumns(area, gap, opts)
+			if err != nil || done {
+				return err
+			}
+			continue
+		}
+
+		// 3. 上下にはみ出すテキストを内側に移動する
+		if r.Sub == nil {
+			r.Main.move(0, shiftInto(r.Main.Bounds.Min.Y, r.Main.Bounds.Max.Y, area.Min.Y, area.Max.Y))
+			return nil
+		}
+
+		main, sub := r.Main, r.Sub
+		needed := main.Bounds.Dy() + gap + sub.Bounds.Dy()
+		if needed > height {
+			// 2行が縦に収まらない場合は両方を縮小してやり直す
+			scale := float64(height) / float64(needed) * 0.95
+			for _, b := range r.Boxes() {
+				if err := b.resize(b.FontSize * scale); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		main.move(0, shiftInto(main.Bounds.Min.Y, main.Bounds.Max.Y, area.Min.Y, area.Max.Y))
+		sub.move(0, shiftInto(sub.Bounds.Min.Y, sub.Bounds.Max.Y, area.Min.Y, area.Max.Y))
+		if main.Bounds.Overlaps(sub.Bounds) || opts.Gap > 0 && sub.Bounds.Min.Y < main.Bounds.Max.Y+gap {
+			// サブテキストをメインテキストのすぐ下に置き、下端からはみ出した分だけ2行まとめて上げる
+			sub.move(0, main.Bounds.Max.Y+gap-sub.Bounds.Min.Y)
+			if over := sub.Bounds.Max.Y - area.Max.Y; over > 0 {
+				main.move(0, -over)
+				sub.move(0, -over)
+			}
+		}
+		if main.Bounds.In(area) && sub.Bounds.In(area) && !main.Bounds.Overlaps(sub.Bounds) {
+			return nil
+		}
+	}
+	// 1ピクセルの画像のように、縮めても重ならずに収められない場合
+	return &Error{Stage: StageLayout, Kind: ErrTextOverflow, Err: errors.Errorf("no layout found for %dx%d after %d iterations", canvas.Dx(), canvas.Dy(), maxFitIterations)}
+}
+
+// fitColumns は縦書きのテキストを上下方向に収め、メインテキストとサブテキストの列が重ならないようにする
+// 収まった場合はtrueを返し、2列が横に収まらず縮小した場合はfalseを返す
+func (r *LayoutResult) fitColumns(area image.Rectangle, gap int, opts LayoutOptions) (bool, error) {
+	for _, b := range r.Boxes() {
+		b.move(0, shiftInto(b.Bounds.Min.Y, b.Bounds.Max.Y, area.Min.Y, area.Max.Y))
+	}
+	if r.Sub == nil {
+		return true, nil
+	}
+
+	main, sub := r.Main, r.Sub
+	needed := main.Bounds.Dx() + gap + sub.Bounds.Dx()
+	if needed > area.Dx() {
+		// 2列が横に収まらない場合は両方を縮小してやり直す
+		scale := float64(area.Dx()) / float64(needed) * 0.95
+		for _, b := range r.Boxes() {
+			if err := b.resize(b.FontSize * scale); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	if main.Bounds.Overlaps(sub.Bounds) || opts.Gap > 0 && sub.Bounds.Max.X > main.Bounds.Min.X-gap {
+		// サブテキストをメインテキストのすぐ左に置き、左端からはみ出した分だけ2列まとめて右に寄せる
+		sub.move(main.Bounds.Min.X-gap-sub.Bounds.Max.X, 0)
+		if over := area.Min.X - sub.Bounds.Min.X; over > 0 {
+			main.move(over, 0)
+			sub.move(over, 0)
+		}
+	}
+	return main.Bounds.In(area) && sub.Bounds.In(area) && !main.Bounds.Overlaps(sub.Bounds), nil
+}
+
+// saliencyMoveCost は重要度の低い範囲にテキストを動かすときの移動のコスト
+// 対角線の長さだけ動かすと、テキストの範囲全体に重要度0.05が加わるのと同じとみなし、平坦な画像ではテキストを動かさない
+const saliencyMoveCost = 0.05
+
+// place はメインテキストとサブテキストを、位置関係を保ったまま重要度の合計が最も小さい位置にまとめて動かす
+// 候補の位置は余白を除いた範囲の中で、短辺の1/32の間隔で試す
+func (r *LayoutResult) place(canvas image.Rectangle, opts LayoutOptions) error {
+	if size := opts.Saliency.Size(); size != canvas.Size() {
+		return errors.Errorf("saliency map size %v does not match the image size %v", size, canvas.Size())
+	}
+	area := opts.area(canvas)
+	group := image.Rectangle{}
+	for _, b := range r.Boxes() {
+		group = group.Union(b.Bounds)
+	}
+	step := max(1, min(area.Dx(), area.Dy())/32)
+	diagonal := math.Hypot(float64(canvas.Dx()), float64(canvas.Dy()))
+	moveCost := saliencyMoveCost * float64(group.Dx()*group.Dy()) / diagonal
+
+	cost := func(d image.Point) float64 {
+		sum := moveCost * math.Hypot(float64(d.X), float64(d.Y))
+		for _, b := range r.Boxes() {
+			sum += opts.Saliency.Sum(b.Bounds.Add(d))
+		}
+		return sum
+	}
+	best, bestCost := image.Point{}, cost(image.Point{})
+	for _, x := range placements(group.Min.X, group.Dx(), area.Min.X, area.Max.X, step) {
+		for _, y := range placements(group.Min.Y, group.Dy(), area.Min.Y, area.Max.Y, step) {
+			d := image.Pt(x-group.Min.X, y-group.Min.Y)
+			if c := cost(d); c < bestCost {
+				best, bestCost = d, c
+			}
+		}
+	}
+	for _, b := range r.Boxes() {
+		b.move(best.X, best.Y)
+	}
+	return nil
+}
+
+// placements は長さsizeの範囲を[start, end)に収める左端（上端）の候補を返す
+// 収まらない場合は今の位置だけを返す
+func placements(current, size, start, end, step int) []int {
+	if size > end-start {
+		return []int{current}
+	}
+	var positions []int
+	for p := start; p < end-size; p += step {
+		positions = append(positions, p)
+	}
+	return append(positions, end-size)
+}
+
+// area はマージンを除いた、テキストを置ける範囲を返す
+// マージンが大きすぎる場合はキャンバス全体を使う
+func (o LayoutOptions) area(canvas image.Rectangle) image.Rectangle {
+	area := image.Rect(0, 0, canvas.Dx(), canvas.Dy()).Inset(o.Margin)
+	if area.Empty() {
+		area = image.Rect(0, 0, canvas.Dx(), canvas.Dy())
+	}
+	return area
+}
+
+// shiftInto は[lo, hi)を[start, end)の内側に収めるための移動量を返す
+func shiftInto(lo, hi, start, end int) int {
+	switch {
+	case lo < start:
+		return start - lo
+	case hi > end:
+		return end - hi
+	}
+	return 0
+}
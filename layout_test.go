@@ -0,0 +1,243 @@
+package lgtm
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layoutCase はレイアウトのプロパティテストの入力
+type layoutCase struct {
+	Width, Height int
+	Main, Sub     string
+}
+
+func (c layoutCase) String() string {
+	return fmt.Sprintf("%dx%d main=%q sub=%q", c.Width, c.Height, c.Main, c.Sub)
+}
+
+const layoutAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789 !?#@"
+
+// Generate は極端な縦横比を含む画像サイズと、空白を含むランダムな文字列を生成する
+func (layoutCase) Generate(r *rand.Rand, _ int) reflect.Value {
+	// 面積と縦横比を対数一様に選ぶ（縦横比は1:10〜10:1）
+	area := math.Exp(math.Log(40*40) + r.Float64()*(math.Log(3000*2000)-math.Log(40*40)))
+	aspect := math.Exp((r.Float64()*2 - 1) * math.Log(10))
+	width := max(int(math.Sqrt(area*aspect)), 24)
+	height := max(int(math.Sqrt(area/aspect)), 24)
+
+	randomText := func(minLen, maxLen int) string {
+		b := make([]byte, minLen+r.Intn(maxLen-minLen+1))
+		for i := range b {
+			b[i] = layoutAlphabet[r.Intn(len(layoutAlphabet))]
+		}
+		return string(b)
+	}
+	return reflect.ValueOf(layoutCase{
+		Width:  width,
+		Height: height,
+		Main:   randomText(1, 16),
+		Sub:    randomText(0, 32),
+	})
+}
+
+// checkLayout はテキストが画像に収まり、メインテキストとサブテキストが重ならないことを検査する
+func checkLayout(c layoutCase) error {
+	canvas := image.Rect(0, 0, c.Width, c.Height)
+	r, err := Layout(canvas, NewMainText(c.Main, TextColorWhite), NewSubText(c.Sub, TextColorWhite), LayoutOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, b := range r.Boxes() {
+		if !b.Bounds.In(canvas) {
+			return fmt.Errorf("%s: %q %v overflows the image", c, b.Text.Text, b.Bounds)
+		}
+		if b.FontSize <= 0 {
+			return fmt.Errorf("%s: %q has font size %v", c, b.Text.Text, b.FontSize)
+		}
+	}
+	if r.Sub != nil && r.Main.Bounds.Overlaps(r.Sub.Bounds) {
+		return fmt.Errorf("%s: main %v overlaps sub %v", c, r.Main.Bounds, r.Sub.Bounds)
+	}
+	return nil
+}
+
+func TestLayout_Properties(t *testing.T) {
+	count := 300
+	if testing.Short() {
+		count = 50
+	}
+
+	err := quick.Check(func(c layoutCase) bool {
+		if err := checkLayout(c); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}, &quick.Config{MaxCount: count, Rand: rand.New(rand.NewSource(1))})
+	assert.NoError(t, err)
+}
+
+func TestLayout_Fixed(t *testing.T) {
+	// testdata/imagesと同じ縦横比と、テキストが収まりにくい組み合わせ
+	tests := []layoutCase{
+		{Width: 640, Height: 480, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 1000, Height: 100, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 100, Height: 1000, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 2000, Height: 200, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 120, Height: 80, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 24, Height: 24, Main: DefaultMainText, Sub: DefaultSubText},
+		{Width: 300, Height: 30, Main: "LOOKS GOOD TO ME", Sub: "Really really really long sub text"},
+		{Width: 60, Height: 600, Main: "WWWWWWWWWWWWWWWW", Sub: "mmmmmmmmmmmmmmmmmmmmmmmmmmmm"},
+		{Width: 400, Height: 300, Main: "gjpqy", Sub: "ÄÖÜ"},
+		{Width: 400, Height: 300, Main: "   ", Sub: "   "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.String(), func(t *testing.T) {
+			assert.NoError(t, checkLayout(tt))
+		})
+	}
+
+	// 1ピクセルには2行を重ねずに置けないため、fitの上限回数に達してエラーになる
+	tt := layoutCase{Width: 1, Height: 1, Main: DefaultMainText, Sub: DefaultSubText}
+	t.Run(tt.String(), func(t *testing.T) {
+		assert.ErrorIs(t, checkLayout(tt), ErrTextOverflow)
+	})
+}
+
+func TestLayout(t *testing.T) {
+	canvas := image.Rect(0, 0, 640, 480)
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	sub := NewSubText(DefaultSubText, TextColorWhite)
+
+	r, err := Layout(canvas, main, sub, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Same(t, main, r.Main.Text)
+	assert.Same(t, sub, r.Sub.Text)
+	assert.Less(t, r.Main.Bounds.Max.Y, r.Sub.Bounds.Min.Y, "sub text is below main text")
+	assert.InDelta(t, canvas.Dx()/2, (r.Main.Bounds.Min.X+r.Main.Bounds.Max.X)/2, 2, "main text is centered")
+	for _, b := range r.Boxes() {
+		// グリフはベースラインからアセント・ディセントの範囲に収まり、送り幅の分だけ右に伸びる
+		assert.Greater(t, b.Ascent, 0.0)
+		assert.Greater(t, b.Descent, 0.0)
+		assert.GreaterOrEqual(t, float64(b.Bounds.Min.Y), math.Floor(b.Baseline.Y-b.Ascent))
+		assert.LessOrEqual(t, float64(b.Bounds.Max.Y), math.Ceil(b.Baseline.Y+b.Descent))
+		assert.InDelta(t, b.Baseline.X+b.Width, float64(b.Bounds.Max.X), b.FontSize/4)
+		// 描画されるグリフの中心がPointに一致する
+		assert.InDelta(t, b.Point.X, float64(b.Bounds.Min.X+b.Bounds.Max.X)/2, 1)
+		assert.InDelta(t, b.Point.Y, float64(b.Bounds.Min.Y+b.Bounds.Max.Y)/2, 1)
+	}
+
+	r, err = Layout(canvas, main, nil, LayoutOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, r.Sub)
+
+	_, err = Layout(canvas, &Text{Text: "LGTM", Font: Font("broken"), MessageType: MessageTypeMain}, nil, LayoutOptions{})
+	assert.ErrorIs(t, err, ErrFontLoad)
+}
+
+func TestLayout_Options(t *testing.T) {
+	canvas := image.Rect(0, 0, 400, 300)
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	sub := NewSubText(DefaultSubText, TextColorWhite)
+
+	r, err := Layout(canvas, main, sub, LayoutOptions{Margin: 40, Gap: 30})
+	require.NoError(t, err)
+	inner := canvas.Inset(40)
+	for _, b := range r.Boxes() {
+		assert.True(t, b.Bounds.In(inner), "%q %v is inside the margin %v", b.Text.Text, b.Bounds, inner)
+	}
+	assert.GreaterOrEqual(t, r.Sub.Bounds.Min.Y-r.Main.Bounds.Max.Y, 30)
+
+	// 画像より大きいマージンは無視する
+	r, err = Layout(canvas, main, sub, LayoutOptions{Margin: 1000})
+	require.NoError(t, err)
+	for _, b := range r.Boxes() {
+		assert.True(t, b.Bounds.In(canvas))
+	}
+}
+
+func TestLayout_MatchesInk(t *testing.T) {
+	// 実際に描画したピクセルの範囲がBoundsに収まり、その中心がPointに一致する
+	for _, text := range []string{"LGTM", "gjpqy", "Ty.", "AVAWA"} {
+		t.Run(text, func(t *testing.T) {
+			d := &TextDrawer{MainText: NewMainText(text, TextColorWhite)}
+			dc := gg.NewContext(400, 300)
+			dc.SetColor(color.Black)
+			dc.Clear()
+
+			layout, err := d.layout(context.Background(), image.Rect(0, 0, 400, 300))
+			require.NoError(t, err)
+			render, err := d.renderer(layout)
+			require.NoError(t, err)
+			require.NoError(t, render(dc, 0))
+
+			ink := image.Rectangle{}
+			img := dc.Image()
+			for y := 0; y < 300; y++ {
+				for x := 0; x < 400; x++ {
+					if r, _, _, _ := img.At(x, y).RGBA(); r > 0x8000 {
+						ink = ink.Union(image.Rect(x, y, x+1, y+1))
+					}
+				}
+			}
+			b := layout.Main
+			assert.True(t, ink.In(b.Bounds), "ink %v is inside %v", ink, b.Bounds)
+			assert.InDelta(t, b.Point.X, float64(ink.Min.X+ink.Max.X)/2, 1.5)
+			assert.InDelta(t, b.Point.Y, float64(ink.Min.Y+ink.Max.Y)/2, 1.5)
+		})
+	}
+}
+
+func TestLayout_Sizes(t *testing.T) {
+	canvas := image.Rect(0, 0, 1200, 900)
+	main := NewMainText(DefaultMainText, TextColorWhite)
+
+	tests := []struct {
+		name     string
+		sub      string
+		opts     LayoutOptions
+		mainSize float64
+		subSize  float64
+	}{
+		{name: "fixed sizes", sub: DefaultSubText, opts: LayoutOptions{Size: 80, SubSize: 30}, mainSize: 80, subSize: 30},
+		{name: "sub ratio", sub: DefaultSubText, opts: LayoutOptions{Size: 80, SubRatio: 0.25}, mainSize: 80, subSize: 20},
+		{name: "sub size wins over ratio", sub: DefaultSubText, opts: LayoutOptions{Size: 80, SubSize: 30, SubRatio: 0.25}, mainSize: 80, subSize: 30},
+		{name: "max sizes", sub: DefaultSubText, opts: LayoutOptions{Size: 80, SubSize: 60, MaxSize: 50, MaxSubSize: 10}, mainSize: 50, subSize: 10},
+		{name: "explicit sub size may exceed main", sub: "ok", opts: LayoutOptions{Size: 40, SubSize: 60}, mainSize: 40, subSize: 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Layout(canvas, main, NewSubText(tt.sub, TextColorWhite), tt.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.mainSize, r.Main.FontSize)
+			assert.Equal(t, tt.subSize, r.Sub.FontSize)
+		})
+	}
+
+	// 自動で決めた短いサブテキストはメインテキストより大きくならない
+	r, err := Layout(canvas, main, NewSubText("ok", TextColorWhite), LayoutOptions{})
+	require.NoError(t, err)
+	assert.LessOrEqual(t, r.Sub.FontSize, r.Main.FontSize)
+
+	// 指定したサイズが画像に収まらない場合は縮小する
+	r, err = Layout(image.Rect(0, 0, 200, 100), main, nil, LayoutOptions{Size: 400})
+	require.NoError(t, err)
+	assert.Less(t, r.Main.FontSize, 400.0)
+	assert.True(t, r.Main.Bounds.In(image.Rect(0, 0, 200, 100)))
+
+	_, err = Layout(canvas, main, nil, LayoutOptions{SubRatio: -1})
+	assert.ErrorContains(t, err, "SubRatio -1")
+}
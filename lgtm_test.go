@@ -1,7 +1,19 @@
 package lgtm
 
 import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTextDrawer_WhiteText(t *testing.T) {
@@ -322,10 +334,203 @@ func TestTextDrawer_WhiteText(t *testing.T) {
 			main := NewMainText(tt.args.mainText, tt.args.textColor)
 			sub := NewSubText(tt.args.subText, tt.args.textColor)
 
-			d := NewTextDrawer(main, sub, tt.args.inputPath, tt.args.outputPath)
+			// testdata/resultsはREADME用の画像のため、テストでは一時ディレクトリに出力する
+			// 描画結果の比較は golden_test.go で行う
+			outputPath := filepath.Join(t.TempDir(), filepath.Base(tt.args.outputPath))
+			d := NewTextDrawer(main, sub, tt.args.inputPath, outputPath)
 			if err := d.Draw(); err != nil {
 				t.Fatal(err)
 			}
 		})
 	}
 }
+
+// writeTestGIF はテスト用のアニメーションGIFを生成する
+func writeTestGIF(tb testing.TB, path string, frames, width, height int) {
+	tb.Helper()
+
+	palette := color.Palette{color.Black, color.White, color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}}
+	g := &gif.GIF{
+		Config: image.Config{ColorModel: palette, Width: width, Height: height},
+	}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		draw.Draw(frame, frame.Rect, image.NewUniform(palette[2+i%2]), image.Point{}, draw.Src)
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10+i)
+		g.Disposal = append(g.Disposal, gif.DisposalBackground)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := gif.EncodeAll(f, g); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestTextDrawer_GIF(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "input.gif")
+	outputPath := filepath.Join(dir, "output.gif")
+	writeTestGIF(t, inputPath, 5, 320, 240)
+
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	sub := NewSubText(DefaultSubText, TextColorWhite)
+	d := NewTextDrawer(main, sub, inputPath, outputPath)
+	require.NoError(t, d.Draw())
+
+	f, err := os.Open(outputPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	got, err := gif.DecodeAll(f)
+	require.NoError(t, err)
+	assert.Len(t, got.Image, 5)
+	assert.Equal(t, []int{10, 11, 12, 13, 14}, got.Delay)
+	for _, disposal := range got.Disposal {
+		assert.Equal(t, byte(gif.DisposalBackground), disposal)
+	}
+}
+
+func TestTextDrawer_layout(t *testing.T) {
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	sub := NewSubText(DefaultSubText, TextColorWhite)
+	d := &TextDrawer{MainText: main, SubText: sub}
+
+	img := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	layout, err := d.layout(context.Background(), img.Bounds())
+	require.NoError(t, err)
+	require.NotNil(t, layout.Sub)
+
+	// 収まっている場合のレイアウトはFontSize/Pointと同じ結果になる
+	assert.Equal(t, main.FontSize(img), layout.Main.FontSize)
+	assert.Equal(t, *main.Point(img), layout.Main.Point)
+	assert.Equal(t, *sub.Point(img), layout.Sub.Point)
+
+	// サブテキストが空の場合はメインテキストのみ
+	d.SubText = NewSubText("", TextColorWhite)
+	layout, err = d.layout(context.Background(), img.Bounds())
+	require.NoError(t, err)
+	assert.Nil(t, layout.Sub)
+	assert.Len(t, layout.Boxes(), 1)
+}
+
+func BenchmarkDrawer_GIF(b *testing.B) {
+	dir := b.TempDir()
+	inputPath := filepath.Join(dir, "input.gif")
+	writeTestGIF(b, inputPath, 300, 320, 240)
+
+	drawers := []struct {
+		name   string
+		drawer func(outputPath string, workers int) Drawer
+	}{
+		{
+			name: "text",
+			drawer: func(outputPath string, workers int) Drawer {
+				main := NewMainText(DefaultMainText, TextColorWhite)
+				sub := NewSubText(DefaultSubText, TextColorWhite)
+				return &TextDrawer{MainText: main, SubText: sub, InputPath: inputPath, OutputPath: outputPath, Workers: workers}
+			},
+		},
+		{
+			name: "gopher",
+			drawer: func(outputPath string, workers int) Drawer {
+				return &GopherDrawer{InputPath: inputPath, OutputPath: outputPath, Workers: workers}
+			},
+		},
+		{
+			name: "concentration",
+			drawer: func(outputPath string, workers int) Drawer {
+				d := NewConcentrationLinesDrawer(inputPath, outputPath).(*ConcentrationLinesDrawer)
+				d.Workers = workers
+				return d
+			},
+		},
+	}
+	for _, dd := range drawers {
+		for _, workers := range []int{1, 0} {
+			name := fmt.Sprintf("%s/workers=%d", dd.name, workers)
+			b.Run(name, func(b *testing.B) {
+				outputPath := filepath.Join(dir, dd.name+".gif")
+				d := dd.drawer(outputPath, workers)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := d.Draw(); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(300*b.N)/b.Elapsed().Seconds(), "frames/s")
+			})
+		}
+	}
+}
+
+func TestDrawer_DrawContext(t *testing.T) {
+	dir := t.TempDir()
+	gifPath := filepath.Join(dir, "input.gif")
+	writeTestGIF(t, gifPath, 10, 64, 64)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	drawers := map[string]func(inputPath, outputPath string) Drawer{
+		"text": func(inputPath, outputPath string) Drawer {
+			return NewTextDrawer(NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite), inputPath, outputPath)
+		},
+		"gopher":        NewGopherDrawer,
+		"concentration": NewConcentrationLinesDrawer,
+		"speed":         NewSpeedLinesDrawer,
+		"beta":          NewBetaFlashDrawer,
+		"screentone":    NewScreentoneDrawer,
+		"burst":         NewImpactBurstDrawer,
+	}
+	inputs := map[string]string{
+		"gif": gifPath,
+		"jpg": "testdata/images/test_small.jpg",
+	}
+	for name, newDrawer := range drawers {
+		for format, inputPath := range inputs {
+			t.Run(name+"/"+format, func(t *testing.T) {
+				outputPath := filepath.Join(dir, name+"."+format)
+
+				err := DrawContext(canceled, newDrawer(inputPath, outputPath))
+				assert.ErrorIs(t, err, context.Canceled)
+				assert.NoFileExists(t, outputPath)
+
+				err = DrawContext(expired, newDrawer(inputPath, outputPath))
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.NoFileExists(t, outputPath)
+
+				assert.NoError(t, DrawContext(context.Background(), newDrawer(inputPath, outputPath)))
+				assert.FileExists(t, outputPath)
+			})
+		}
+	}
+}
+
+// drawOnly はDrawContextを持たない外部のDrawer
+type drawOnly struct{ calls int }
+
+func (d *drawOnly) Draw() error {
+	d.calls++
+	return nil
+}
+
+func TestDrawContext_Drawer(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// DrawContextを持たないDrawerは描画の前にだけキャンセルを確認する
+	d := &drawOnly{}
+	assert.ErrorIs(t, DrawContext(canceled, d), context.Canceled)
+	assert.Zero(t, d.calls)
+	assert.NoError(t, DrawContext(context.Background(), d))
+	assert.Equal(t, 1, d.calls)
+}
@@ -0,0 +1,227 @@
+package lgtm
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLimitExceeded は入力画像が Limits を超えている場合に返るエラー
+// 詳細は errors.As で *LimitError として取り出せる
+var ErrLimitExceeded = errors.New("input image exceeds limits")
+
+// LimitError はどの上限をどれだけ超えたかを表す
+type LimitError struct {
+	Limit string // 超過した上限の名前（"file size", "width" など）
+	Value int64  // 入力画像の値
+	Max   int64  // 上限値
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeds limit %d", e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Limits はデコード前にヘッダから検査する入力画像の上限
+// 0の項目は無制限として扱う
+type Limits struct {
+	MaxFileSize    int64 // 入力ファイルのバイト数
+	MaxWidth       int   // 画像（GIFでは論理スクリーンと各フレーム）の幅
+	MaxHeight      int   // 画像（GIFでは論理スクリーンと各フレーム）の高さ
+	MaxPixels      int64 // 画像1枚（GIFでは1フレーム）あたりのピクセル数
+	MaxTotalPixels int64 // GIFの全フレームの合計ピクセル数
+	MaxFrames      int   // GIFのフレーム数
+}
+
+// DefaultLimits は各Drawerのコンストラクタが設定する上限
+var DefaultLimits = Limits{
+	MaxFileSize:    50 << 20,
+	MaxWidth:       16384,
+	MaxHeight:      16384,
+	MaxPixels:      50_000_000,
+	MaxTotalPixels: 500_000_000,
+	MaxFrames:      2000,
+}
+
+// imageHeader はデコードせずにヘッダから読み取った画像の情報
+type imageHeader struct {
+	Format      string
+	Width       int
+	Height      int
+	Frames      int
+	TotalPixels int64
+}
+
+// inspect はファイルサイズとヘッダを検査して画像フォーマットを返す
+// 上限を超えている場合は画像本体をデコードする前に *LimitError をラップした *Error を返す
+func inspect(path string, limits Limits) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", newError(StageInspect, path, nil, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", newError(StageInspect, path, nil, err)
+	}
+	if err := check("file size", info.Size(), limits.MaxFileSize); err != nil {
+		return "", newError(StageInspect, path, nil, err)
+	}
+
+	header, err := readHeader(bufio.NewReader(f), limits)
+	if err != nil {
+		return "", newError(StageInspect, path, ErrDecode, err)
+	}
+	return header.Format, nil
+}
+
+// readHeader は画像のヘッダを読み取り、上限を検査する
+// GIFは全フレームのイメージディスクリプタを走査するが、LZWデータは展開しない
+func readHeader(r *bufio.Reader, limits Limits) (*imageHeader, error) {
+	magic, err := r.Peek(6)
+	if err == nil && (string(magic) == "GIF87a" || string(magic) == "GIF89a") {
+		return readGIFHeader(r, limits)
+	}
+
+	config, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	header := &imageHeader{
+		Format:      format,
+		Width:       config.Width,
+		Height:      config.Height,
+		Frames:      1,
+		TotalPixels: int64(config.Width) * int64(config.Height),
+	}
+	if err := checkSize(config.Width, config.Height, limits); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func readGIFHeader(r *bufio.Reader, limits Limits) (*imageHeader, error) {
+	// ヘッダ(6) + 論理スクリーンディスクリプタ(7)
+	var buf [13]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, errors.Wrap(err, "gif: reading header")
+	}
+	header := &imageHeader{
+		Format: "gif",
+		Width:  int(buf[6]) | int(buf[7])<<8,
+		Height: int(buf[8]) | int(buf[9])<<8,
+	}
+	if err := checkSize(header.Width, header.Height, limits); err != nil {
+		return nil, err
+	}
+	if err := skipColorTable(r, buf[10]); err != nil {
+		return nil, err
+	}
+
+	for {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "gif: reading block")
+		}
+
+		switch introducer {
+		case 0x21: // 拡張ブロック
+			if _, err := r.ReadByte(); err != nil {
+				return nil, errors.Wrap(err, "gif: reading extension")
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return nil, err
+			}
+
+		case 0x2C: // イメージディスクリプタ
+			var desc [9]byte
+			if _, err := io.ReadFull(r, desc[:]); err != nil {
+				return nil, errors.Wrap(err, "gif: reading image descriptor")
+			}
+			width := int(desc[4]) | int(desc[5])<<8
+			height := int(desc[6]) | int(desc[7])<<8
+			if err := checkSize(width, height, limits); err != nil {
+				return nil, err
+			}
+
+			header.Frames++
+			header.TotalPixels += int64(width) * int64(height)
+			if err := check("frames", int64(header.Frames), int64(limits.MaxFrames)); err != nil {
+				return nil, err
+			}
+			if err := check("total pixels", header.TotalPixels, limits.MaxTotalPixels); err != nil {
+				return nil, err
+			}
+
+			if err := skipColorTable(r, desc[8]); err != nil {
+				return nil, err
+			}
+			// LZW最小コードサイズ
+			if _, err := r.ReadByte(); err != nil {
+				return nil, errors.Wrap(err, "gif: reading image data")
+			}
+			if err := skipSubBlocks(r); err != nil {
+				return nil, err
+			}
+
+		case 0x3B: // トレーラ
+			return header, nil
+
+		default:
+			return nil, fmt.Errorf("gif: unknown block type: 0x%.2x", introducer)
+		}
+	}
+}
+
+// skipColorTable はパック済みフィールドが示すカラーテーブルを読み飛ばす
+func skipColorTable(r *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+	size := 3 * (1 << (int(packed&0x07) + 1))
+	if _, err := r.Discard(size); err != nil {
+		return errors.Wrap(err, "gif: reading color table")
+	}
+	return nil
+}
+
+// skipSubBlocks はブロックターミネータまでのデータサブブロックを読み飛ばす
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return errors.Wrap(err, "gif: reading sub-block")
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return errors.Wrap(err, "gif: reading sub-block")
+		}
+	}
+}
+
+func checkSize(width, height int, limits Limits) error {
+	if err := check("width", int64(width), int64(limits.MaxWidth)); err != nil {
+		return err
+	}
+	if err := check("height", int64(height), int64(limits.MaxHeight)); err != nil {
+		return err
+	}
+	return check("pixels", int64(width)*int64(height), limits.MaxPixels)
+}
+
+func check(limit string, value, max int64) error {
+	if max > 0 && value > max {
+		return &LimitError{Limit: limit, Value: value, Max: max}
+	}
+	return nil
+}
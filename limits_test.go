@@ -0,0 +1,83 @@
+package lgtm
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gifBomb は論理スクリーンだけが巨大な、画像データを持たないGIF
+func gifBomb(width, height int) []byte {
+	b := []byte("GIF89a")
+	b = append(b, byte(width), byte(width>>8), byte(height), byte(height>>8), 0, 0, 0)
+	return append(b, 0x3B)
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+
+	gifPath := filepath.Join(dir, "anim.gif")
+	writeTestGIF(t, gifPath, 20, 100, 50)
+
+	pngPath := filepath.Join(dir, "still.png")
+	buf := &bytes.Buffer{}
+	require.NoError(t, png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 200, 100))))
+	require.NoError(t, os.WriteFile(pngPath, buf.Bytes(), 0o644))
+
+	bombPath := filepath.Join(dir, "bomb.gif")
+	require.NoError(t, os.WriteFile(bombPath, gifBomb(50000, 50000), 0o644))
+
+	tests := []struct {
+		name      string
+		path      string
+		limits    Limits
+		want      string
+		wantLimit string
+	}{
+		{name: "GIF 上限なし", path: gifPath, limits: Limits{}, want: "gif"},
+		{name: "GIF デフォルト上限", path: gifPath, limits: DefaultLimits, want: "gif"},
+		{name: "PNG デフォルト上限", path: pngPath, limits: DefaultLimits, want: "png"},
+		{name: "ファイルサイズ超過", path: pngPath, limits: Limits{MaxFileSize: 10}, wantLimit: "file size"},
+		{name: "幅超過", path: pngPath, limits: Limits{MaxWidth: 199}, wantLimit: "width"},
+		{name: "高さ超過", path: gifPath, limits: Limits{MaxHeight: 49}, wantLimit: "height"},
+		{name: "ピクセル数超過", path: pngPath, limits: Limits{MaxPixels: 19999}, wantLimit: "pixels"},
+		{name: "フレーム数超過", path: gifPath, limits: Limits{MaxFrames: 19}, wantLimit: "frames"},
+		{name: "合計ピクセル数超過", path: gifPath, limits: Limits{MaxTotalPixels: 100 * 50 * 10}, wantLimit: "total pixels"},
+		{name: "巨大な論理スクリーン", path: bombPath, limits: DefaultLimits, wantLimit: "width"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspect(tt.path, tt.limits)
+			if tt.wantLimit == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrLimitExceeded)
+			var limitErr *LimitError
+			require.True(t, errors.As(err, &limitErr))
+			assert.Equal(t, tt.wantLimit, limitErr.Limit)
+		})
+	}
+}
+
+func TestTextDrawer_Limits(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "bomb.gif")
+	outputPath := filepath.Join(dir, "output.gif")
+	require.NoError(t, os.WriteFile(inputPath, gifBomb(50000, 50000), 0o644))
+
+	main := NewMainText(DefaultMainText, TextColorWhite)
+	sub := NewSubText(DefaultSubText, TextColorWhite)
+	d := NewTextDrawer(main, sub, inputPath, outputPath)
+	assert.ErrorIs(t, d.Draw(), ErrLimitExceeded)
+	assert.NoFileExists(t, outputPath)
+}
@@ -0,0 +1,250 @@
+package lgtm
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+)
+
+// saliencyCells は重要度を計算する格子の長辺のセル数の上限
+const saliencyCells = 96
+
+// SaliencyMap は画像のどこに被写体があるかを表す重要度の地図
+// 画像を格子に分け、画像全体の平均と違う色・輪郭の多さ・肌色の割合からセルごとの重要度を0〜1で求める
+// 顔や被写体の輪郭は重要度が高く、空や壁のような平坦な背景は低くなる
+type SaliencyMap struct {
+	width, height int // 元の画像の大きさ
+	cell          int // 1セルの一辺のピクセル数
+	cols, rows    int
+	values        []float64 // セルの重要度（行優先）
+	integral      []float64 // (cols+1)×(rows+1)の重要度の累積和
+}
+
+// NewSaliencyMap は画像の重要度を計算する
+func NewSaliencyMap(img image.Image) *SaliencyMap {
+	bounds := img.Bounds()
+	m := &SaliencyMap{width: bounds.Dx(), height: bounds.Dy(), cell: 1}
+	if bounds.Empty() {
+		m.integral = []float64{0}
+		return m
+	}
+	m.cell = max(1, (max(m.width, m.height)+saliencyCells-1)/saliencyCells)
+	m.cols = (m.width + m.cell - 1) / m.cell
+	m.rows = (m.height + m.cell - 1) / m.cell
+
+	n := m.cols * m.rows
+	luma, cb, cr, skin := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	var meanY, meanCb, meanCr float64
+	// 大きな画像でも速く計算できるよう、1セルあたり最大4×4ピクセルだけを読む
+	stride := max(1, m.cell/4)
+	for row := 0; row < m.rows; row++ {
+		for col := 0; col < m.cols; col++ {
+			i := row*m.cols + col
+			cell := image.Rect(col*m.cell, row*m.cell, (col+1)*m.cell, (row+1)*m.cell).
+				Add(bounds.Min).Intersect(bounds)
+			samples := 0.0
+			for y := cell.Min.Y; y < cell.Max.Y; y += stride {
+				for x := cell.Min.X; x < cell.Max.X; x += stride {
+					c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+					yy, u, v := color.RGBToYCbCr(c.R, c.G, c.B)
+					luma[i] += float64(yy)
+					cb[i] += float64(u)
+					cr[i] += float64(v)
+					if isSkinColor(yy, u, v) {
+						skin[i]++
+					}
+					samples++
+				}
+			}
+			luma[i] /= samples * 255
+			cb[i] /= samples * 255
+			cr[i] /= samples * 255
+			skin[i] /= samples
+			meanY += luma[i]
+			meanCb += cb[i]
+			meanCr += cr[i]
+		}
+	}
+	meanY, meanCb, meanCr = meanY/float64(n), meanCb/float64(n), meanCr/float64(n)
+
+	// 1. 画像全体の平均の色との差（平坦な背景から浮き出た被写体ほど大きい）
+	contrast := make([]float64, n)
+	for i := range contrast {
+		contrast[i] = math.Sqrt(sq(luma[i]-meanY) + sq(cb[i]-meanCb) + sq(cr[i]-meanCr))
+	}
+	// 2. Sobelフィルタによる輝度の勾配（輪郭や細かい模様ほど大きい）
+	edges := make([]float64, n)
+	at := func(col, row int) float64 {
+		col = min(max(col, 0), m.cols-1)
+		row = min(max(row, 0), m.rows-1)
+		return luma[row*m.cols+col]
+	}
+	for row := 0; row < m.rows; row++ {
+		for col := 0; col < m.cols; col++ {
+			gx := at(col+1, row-1) + 2*at(col+1, row) + at(col+1, row+1) - at(col-1, row-1) - 2*at(col-1, row) - at(col-1, row+1)
+			gy := at(col-1, row+1) + 2*at(col, row+1) + at(col+1, row+1) - at(col-1, row-1) - 2*at(col, row-1) - at(col+1, row-1)
+			edges[row*m.cols+col] = math.Hypot(gx, gy)
+		}
+	}
+
+	// 3. 肌色の割合を顔の目安として加え、周囲のセルにも広げる
+	normalize(contrast)
+	normalize(edges)
+	m.values = make([]float64, n)
+	for i := range m.values {
+		m.values[i] = 0.4*contrast[i] + 0.4*edges[i] + 0.6*skin[i]
+	}
+	m.values = m.blur(m.blur(m.values))
+	normalize(m.values)
+
+	m.integral = make([]float64, (m.cols+1)*(m.rows+1))
+	for row := 0; row < m.rows; row++ {
+		for col := 0; col < m.cols; col++ {
+			m.integral[(row+1)*(m.cols+1)+col+1] = m.values[row*m.cols+col] +
+				m.integral[row*(m.cols+1)+col+1] + m.integral[(row+1)*(m.cols+1)+col] - m.integral[row*(m.cols+1)+col]
+		}
+	}
+	return m
+}
+
+// LoadSaliency は画像ファイルの重要度を計算する。GIFは最初のフレームを使う
+func LoadSaliency(path string) (*SaliencyMap, error) {
+	ext, err := inspect(path, DefaultLimits)
+	if err != nil {
+		return nil, err
+	}
+	if ext != "gif" {
+		img, err := openImage(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewSaliencyMap(img), nil
+	}
+
+	g, err := openGIF(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSaliencyMap(firstFrame(g)), nil
+}
+
+// firstFrame はGIFの最初のフレームを論理スクリーンの大きさの画像に描く
+func firstFrame(g *gif.GIF) image.Image {
+	screen := image.NewRGBA(gifScreen(g))
+	if len(g.Image) > 0 {
+		draw.Draw(screen, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	}
+	return screen
+}
+
+// Size は重要度を計算した画像の大きさを返す
+func (m *SaliencyMap) Size() image.Point {
+	return image.Pt(m.width, m.height)
+}
+
+// At は画像の左上を原点とするピクセルの重要度を0〜1で返す。画像の外は0を返す
+func (m *SaliencyMap) At(x, y int) float64 {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return 0
+	}
+	return m.values[(y/m.cell)*m.cols+x/m.cell]
+}
+
+// Sum は画像の左上を原点とする範囲の重要度の合計を返す
+// 範囲に一部でもかかるセルは全体を数え、1ピクセルあたりの重要度×ピクセル数を返す
+func (m *SaliencyMap) Sum(r image.Rectangle) float64 {
+	r = r.Intersect(image.Rect(0, 0, m.width, m.height))
+	if r.Empty() {
+		return 0
+	}
+	col0, row0 := r.Min.X/m.cell, r.Min.Y/m.cell
+	col1, row1 := (r.Max.X+m.cell-1)/m.cell, (r.Max.Y+m.cell-1)/m.cell
+	stride := m.cols + 1
+	sum := m.integral[row1*stride+col1] - m.integral[row0*stride+col1] - m.integral[row1*stride+col0] + m.integral[row0*stride+col0]
+	return sum * float64(m.cell*m.cell)
+}
+
+// Focus は被写体の位置として、重要度の最も高い範囲の重心を画像の左上を原点とする座標で返す
+// 縦横1/3の大きさの窓で重要度の合計が最大になる位置を探し、その中の重要度で重み付けした重心を求める
+// 同じくらい重要な範囲が複数ある場合は画像の中心に近い方を選び、平坦な画像では画像の中心を返す
+func (m *SaliencyMap) Focus() Point {
+	center := Point{X: float64(m.width) / 2, Y: float64(m.height) / 2}
+	if len(m.values) == 0 {
+		return center
+	}
+
+	w, h := max(1, m.cols/3), max(1, m.rows/3)
+	stride := m.cols + 1
+	halfDiagonal := math.Hypot(float64(m.cols), float64(m.rows)) / 2
+	best, bestScore := image.Point{}, 0.0
+	for row := 0; row+h <= m.rows; row++ {
+		for col := 0; col+w <= m.cols; col++ {
+			sum := m.integral[(row+h)*stride+col+w] - m.integral[row*stride+col+w] - m.integral[(row+h)*stride+col] + m.integral[row*stride+col]
+			// 画像の中心から離れた窓ほど少しだけ割り引く
+			d := math.Hypot(float64(col)+float64(w)/2-float64(m.cols)/2, float64(row)+float64(h)/2-float64(m.rows)/2) / halfDiagonal
+			if score := sum * (1 - 0.25*d); score > bestScore {
+				best, bestScore = image.Pt(col, row), score
+			}
+		}
+	}
+	if bestScore == 0 {
+		return center
+	}
+
+	var x, y, total float64
+	for row := best.Y; row < best.Y+h; row++ {
+		for col := best.X; col < best.X+w; col++ {
+			v := m.values[row*m.cols+col]
+			x += v * (float64(col) + 0.5)
+			y += v * (float64(row) + 0.5)
+			total += v
+		}
+	}
+	return Point{
+		X: math.Min(x/total*float64(m.cell), float64(m.width)),
+		Y: math.Min(y/total*float64(m.cell), float64(m.height)),
+	}
+}
+
+// blur はセルの重要度を3×3の平均でぼかす
+func (m *SaliencyMap) blur(values []float64) []float64 {
+	out := make([]float64, len(values))
+	for row := 0; row < m.rows; row++ {
+		for col := 0; col < m.cols; col++ {
+			sum, count := 0.0, 0.0
+			for y := max(row-1, 0); y <= min(row+1, m.rows-1); y++ {
+				for x := max(col-1, 0); x <= min(col+1, m.cols-1); x++ {
+					sum += values[y*m.cols+x]
+					count++
+				}
+			}
+			out[row*m.cols+col] = sum / count
+		}
+	}
+	return out
+}
+
+// isSkinColor はYCbCrの色が肌色の範囲にあるかどうかを返す（Chai & Nganの閾値）
+func isSkinColor(y, cb, cr uint8) bool {
+	return y > 40 && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
+
+// normalize は最大値が1になるように値を拡大する
+// 平坦な画像の計算誤差を拡大しないよう、最大値が1/1000未満の場合はすべて0にする
+func normalize(values []float64) {
+	peak := 0.0
+	for _, v := range values {
+		peak = math.Max(peak, v)
+	}
+	if peak < 1e-3 {
+		clear(values)
+		return
+	}
+	for i := range values {
+		values[i] /= peak
+	}
+}
+
+func sq(v float64) float64 { return v * v }
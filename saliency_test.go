@@ -0,0 +1,141 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// busyImage は灰色の画像のrの範囲に白黒の市松模様を描く
+func busyImage(width, height int, r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Rect, image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if (x/6+y/6)%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+func TestNewSaliencyMap(t *testing.T) {
+	// 模様のある範囲は平坦な背景より重要度が高い
+	m := NewSaliencyMap(busyImage(400, 300, image.Rect(40, 30, 200, 130)))
+	assert.Equal(t, image.Pt(400, 300), m.Size())
+	assert.Greater(t, m.At(120, 80), 0.5)
+	assert.Less(t, m.At(350, 250), 0.1)
+	assert.Greater(t, m.Sum(image.Rect(0, 0, 200, 150)), m.Sum(image.Rect(200, 150, 400, 300))*10)
+	assert.Zero(t, m.At(-1, 0))
+	assert.Zero(t, m.At(400, 0))
+
+	// 肌色の範囲は顔の目安として重要度を上げる
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{R: 90, G: 120, B: 160, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(200, 200, 260, 270), image.NewUniform(color.RGBA{R: 224, G: 172, B: 140, A: 255}), image.Point{}, draw.Src)
+	m = NewSaliencyMap(img)
+	assert.Greater(t, m.At(230, 235), 0.9)
+	assert.Less(t, m.At(50, 50), 0.1)
+
+	// 平坦な画像はどこも重要度が0
+	m = NewSaliencyMap(image.NewRGBA(image.Rect(0, 0, 50, 40)))
+	assert.Zero(t, m.Sum(image.Rect(0, 0, 50, 40)))
+
+	// 空の画像
+	m = NewSaliencyMap(image.NewRGBA(image.Rectangle{}))
+	assert.Zero(t, m.Sum(image.Rect(0, 0, 10, 10)))
+}
+
+func TestSaliencyMap_Sum(t *testing.T) {
+	m := NewSaliencyMap(busyImage(960, 480, image.Rect(0, 0, 480, 480)))
+	total := m.Sum(image.Rect(0, 0, 960, 480))
+	assert.InDelta(t, total, m.Sum(image.Rect(0, 0, 480, 480))+m.Sum(image.Rect(480, 0, 960, 480)), 1e-6)
+	// 画像の外は数えない
+	assert.InDelta(t, total, m.Sum(image.Rect(-100, -100, 2000, 2000)), 1e-6)
+	assert.Zero(t, m.Sum(image.Rect(1000, 0, 1100, 100)))
+}
+
+func TestLoadSaliency(t *testing.T) {
+	m, err := LoadSaliency("testdata/images/test_rect_300x200.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(300, 200), m.Size())
+
+	path := filepath.Join(t.TempDir(), "input.gif")
+	writeTestGIF(t, path, 2, 120, 80)
+	m, err = LoadSaliency(path)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(120, 80), m.Size())
+
+	_, err = LoadSaliency("testdata/missing.jpg")
+	assert.Error(t, err)
+}
+
+func TestLayout_Saliency(t *testing.T) {
+	canvas := image.Rect(0, 0, 400, 300)
+	main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+	plain, err := Layout(canvas, main, sub, LayoutOptions{})
+	require.NoError(t, err)
+
+	// 上半分に被写体がある画像では、テキストを下半分に動かす
+	saliency := NewSaliencyMap(busyImage(400, 300, image.Rect(0, 0, 400, 150)))
+	smart, err := Layout(canvas, main, sub, LayoutOptions{Saliency: saliency})
+	require.NoError(t, err)
+	for i, b := range smart.Boxes() {
+		assert.True(t, b.Bounds.In(canvas), "%q %v overflows the image", b.Text.Text, b.Bounds)
+		assert.GreaterOrEqual(t, b.Bounds.Min.Y, 150, "%q %v covers the subject", b.Text.Text, b.Bounds)
+		// フォントサイズとメインテキスト・サブテキストの位置関係は変えない
+		want := plain.Boxes()[i]
+		assert.Equal(t, want.FontSize, b.FontSize)
+		assert.Equal(t, want.Bounds.Size(), b.Bounds.Size())
+	}
+	assert.Equal(t, plain.Sub.Bounds.Min.Sub(plain.Main.Bounds.Min), smart.Sub.Bounds.Min.Sub(smart.Main.Bounds.Min))
+
+	// 平坦な画像ではテキストを動かさない
+	flat := image.NewRGBA(canvas)
+	smart, err = Layout(canvas, main, sub, LayoutOptions{Saliency: NewSaliencyMap(flat)})
+	require.NoError(t, err)
+	assert.Equal(t, plain.Main.Bounds, smart.Main.Bounds)
+	assert.Equal(t, plain.Sub.Bounds, smart.Sub.Bounds)
+
+	// 縦書きのテキストは左右に動かす
+	main.WritingMode = WritingVertical
+	saliency = NewSaliencyMap(busyImage(400, 300, image.Rect(200, 0, 400, 300)))
+	smart, err = Layout(canvas, main, sub, LayoutOptions{Saliency: saliency})
+	require.NoError(t, err)
+	for _, b := range smart.Boxes() {
+		assert.LessOrEqual(t, b.Bounds.Max.X, 200, "%q %v covers the subject", b.Text.Text, b.Bounds)
+	}
+
+	// 大きさの違う画像の重要度は使えない
+	d := &TextDrawer{MainText: main, SubText: sub, Layout: LayoutOptions{Saliency: saliency}}
+	_, err = d.layout(context.Background(), image.Rect(0, 0, 200, 100))
+	assert.Error(t, err)
+}
+
+func TestSaliencyMap_Focus(t *testing.T) {
+	// 被写体の中心を返す
+	focus := NewSaliencyMap(busyImage(400, 300, image.Rect(40, 30, 160, 120))).Focus()
+	assert.InDelta(t, 100, focus.X, 20)
+	assert.InDelta(t, 75, focus.Y, 20)
+
+	// 肌色の範囲を顔の位置とみなす
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	draw.Draw(img, img.Rect, image.NewUniform(color.RGBA{R: 90, G: 120, B: 160, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(200, 200, 260, 270), image.NewUniform(color.RGBA{R: 224, G: 172, B: 140, A: 255}), image.Point{}, draw.Src)
+	focus = NewSaliencyMap(img).Focus()
+	assert.InDelta(t, 230, focus.X, 15)
+	assert.InDelta(t, 235, focus.Y, 15)
+
+	// 平坦な画像と空の画像では画像の中心を返す
+	assert.Equal(t, Point{X: 200, Y: 150}, NewSaliencyMap(image.NewRGBA(image.Rect(0, 0, 400, 300))).Focus())
+	assert.Equal(t, Point{}, NewSaliencyMap(image.NewRGBA(image.Rectangle{})).Focus())
+}
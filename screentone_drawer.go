@@ -0,0 +1,75 @@
+package lgtm
+
+import (
+	"context"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// ScreentoneDrawer は網点のスクリーントーンを重ねる
+// 網点は中心の近くでは描かず、外側ほど大きくなって画像の端を暗くする
+type ScreentoneDrawer struct {
+	InputPath  string
+	OutputPath string
+	DotColor   color.Color // 網点の色
+	Spacing    float64     // 網点の間隔（ピクセル。0なら画像の短辺の1/48）
+	Angle      float64     // 網点の並びの角度（度）
+	Focus      *Point      // 網点を描かない中心（nilなら画像の中心）
+	Workers    int         // ConcentrationLinesDrawer.Workersと同じ
+	Limits     Limits      // ConcentrationLinesDrawer.Limitsと同じ
+}
+
+func NewScreentoneDrawer(inputPath, outputPath string) Drawer {
+	return &ScreentoneDrawer{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		DotColor:   color.Black,
+		Angle:      45, // 漫画のトーンと同じく斜めに並べる
+		Limits:     DefaultLimits,
+	}
+}
+
+func (s *ScreentoneDrawer) Draw() error {
+	return s.DrawContext(context.Background())
+}
+
+func (s *ScreentoneDrawer) DrawContext(ctx context.Context) error {
+	return drawEffect(ctx, s.InputPath, s.OutputPath, "screentone", s.Workers, s.Limits, s.Focus, s.drawScreentone)
+}
+
+// drawScreentone はAngleだけ傾けた格子の点に、中心からの距離に応じた半径の円を描く
+// 中心から最も遠い角までの距離の1/4より内側には描かず、角では隣の網点と接する大きさになる
+func (s *ScreentoneDrawer) drawScreentone(dc *gg.Context, _ int, focus Point) {
+	width, height := float64(dc.Width()), float64(dc.Height())
+	spacing := s.Spacing
+	if spacing <= 0 {
+		spacing = math.Max(math.Min(width, height)/48, 2)
+	}
+	farthest := farthestCorner(dc.Width(), dc.Height(), focus)
+	angle := s.Angle * math.Pi / 180
+	cos, sin := math.Cos(angle), math.Sin(angle)
+
+	dc.SetColor(s.DotColor)
+	// 格子は中心を通り、回転しても画像全体を覆う範囲に並べる
+	n := int(math.Ceil(farthest / spacing))
+	for i := -n; i <= n; i++ {
+		for j := -n; j <= n; j++ {
+			u, v := float64(i)*spacing, float64(j)*spacing
+			x, y := focus.X+u*cos-v*sin, focus.Y+u*sin+v*cos
+			if x < -spacing || y < -spacing || x > width+spacing || y > height+spacing {
+				continue
+			}
+			t := (math.Hypot(u, v)/farthest - 0.25) / 0.75
+			if t <= 0 {
+				continue
+			}
+			// 内側から滑らかに大きくし、角で隣の網点と接する半径にする
+			t = math.Min(t, 1)
+			radius := spacing / 2 * t * t * (3 - 2*t)
+			dc.DrawCircle(x, y, radius)
+			dc.Fill()
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package lgtm
+
+import (
+	"bytes"
+	"math"
+	"unicode"
+
+	"github.com/fogleman/gg"
+	"github.com/go-text/typesetting/di"
+	gotext "github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// shaped はbidiの並べ替えとOpenTypeのシェーピングが必要なテキストかどうかを返す
+// 右から左へ書く文字か結合文字を含む場合だけシェーピングし、それ以外はggで1文字ずつ描く
+// 絵文字の異体字セレクタとキーキャップは結合文字として扱わない
+func (t *Text) shaped() bool {
+	for _, r := range string(t.Text) {
+		if unicode.Is(unicode.M, r) && !unicode.Is(unicode.Variation_Selector, r) && r != combiningKeycap || isRTL(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayString は描画する文字列を返す
+// シェーピングするテキストは文字をつなげて描くため、PaddingTextの文字間の空白を入れない
+func (t *Text) displayString() string {
+	if t.shaped() {
+		return string(t.Text)
+	}
+	return t.Text.String()
+}
+
+func isRTL(r rune) bool {
+	p, _ := bidi.LookupRune(r)
+	return p.Class() == bidi.R || p.Class() == bidi.AL
+}
+
+// baseDirection は最初の強い方向性を持つ文字から段落の向きを決める
+func baseDirection(text []rune) di.Direction {
+	for _, r := range text {
+		p, _ := bidi.LookupRune(r)
+		switch p.Class() {
+		case bidi.L:
+			return di.DirectionLTR
+		case bidi.R, bidi.AL:
+			return di.DirectionRTL
+		}
+	}
+	return di.DirectionLTR
+}
+
+// singleFace はすべての文字を1つのフォントで描くFontmap
+type singleFace struct{ face *gotext.Face }
+
+func (s singleFace) ResolveFace(rune) *gotext.Face { return s.face }
+
+// shapedRuns はテキストを左から右への表示順に並べ替えてシェーピングし、ベースライン上に1列に並べたグリフと全体の送り幅を返す
+// グリフの輪郭はem（ピクセル）の大きさに拡大する。harfbuzzは整数のppemで配置するため、emは切り上げる
+func shapedRuns(t *Text, em float64) ([]glyphRun, float64, error) {
+	face, err := gotext.ParseTTF(bytes.NewReader(t.Font))
+	if err != nil {
+		return nil, 0, &Error{Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+	}
+	size := math.Ceil(em)
+	scale := size / float64(face.Upem())
+
+	text := []rune(string(t.Text))
+	base := baseDirection(text)
+	input := shaping.Input{
+		Text:      text,
+		RunEnd:    len(text),
+		Direction: base,
+		Face:      face,
+		Size:      fixed.I(int(size)),
+	}
+	var segmenter shaping.Segmenter
+	var shaper shaping.HarfbuzzShaper
+	var outputs []shaping.Output
+	for _, in := range segmenter.Split(input, singleFace{face}) {
+		outputs = append(outputs, shaper.Shape(in))
+	}
+
+	var runs []glyphRun
+	pen := 0.0
+	for _, out := range visualOrder(outputs, base) {
+		// 右から左へ書くランのグリフもharfbuzzが表示順に並べて返す
+		for _, g := range out.Glyphs {
+			advance := float64(g.XAdvance) / 64
+			outline, _ := face.GlyphData(g.GlyphID).(gotext.GlyphOutline)
+			runs = append(runs, glyphRun{
+				start:   pen + float64(g.XOffset)/64,
+				dy:      -float64(g.YOffset) / 64,
+				advance: advance,
+				outline: scaleOutline(outline.Segments, scale),
+				bounds: rect{
+					minX: float64(g.XBearing) / 64,
+					minY: -float64(g.YBearing) / 64,
+					maxX: float64(g.XBearing+g.Width) / 64,
+					maxY: -float64(g.YBearing+g.Height) / 64,
+				},
+			})
+			pen += advance
+		}
+	}
+	return runs, pen, nil
+}
+
+// visualOrder は論理順に並んだランを左から右への表示順に並べ替える
+// 段落と逆向きのランが続く部分を反転し、右から左への段落は全体を反転する
+func visualOrder(outputs []shaping.Output, base di.Direction) []shaping.Output {
+	ordered := make([]shaping.Output, len(outputs))
+	copy(ordered, outputs)
+	reverse := func(s []shaping.Output) {
+		for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+			s[i], s[j] = s[j], s[i]
+		}
+	}
+
+	start := -1
+	for i, out := range ordered {
+		if out.Direction.Progression() == base.Progression() {
+			if start >= 0 {
+				reverse(ordered[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		reverse(ordered[start:])
+	}
+	if base.Progression() == di.TowardTopLeft {
+		reverse(ordered)
+	}
+	return ordered
+}
+
+// scaleOutline はフォント単位で上向きのグリフの輪郭を、ピクセル単位で下向きの座標に変換する
+func scaleOutline(segments []gotext.Segment, scale float64) []gotext.Segment {
+	out := make([]gotext.Segment, len(segments))
+	for i, s := range segments {
+		out[i].Op = s.Op
+		for j, p := range s.Args {
+			out[i].Args[j] = gotext.SegmentPoint{X: p.X * float32(scale), Y: -p.Y * float32(scale)}
+		}
+	}
+	return out
+}
+
+// drawOutline はグリフの輪郭を(x, y)をドットとして塗りつぶす
+func drawOutline(dc *gg.Context, outline []gotext.Segment, x, y float64) {
+	pt := func(p gotext.SegmentPoint) (float64, float64) {
+		return x + float64(p.X), y + float64(p.Y)
+	}
+	for _, s := range outline {
+		x1, y1 := pt(s.Args[0])
+		switch s.Op {
+		case opentype.SegmentOpMoveTo:
+			dc.MoveTo(x1, y1)
+		case opentype.SegmentOpLineTo:
+			dc.LineTo(x1, y1)
+		case opentype.SegmentOpQuadTo:
+			x2, y2 := pt(s.Args[1])
+			dc.QuadraticTo(x1, y1, x2, y2)
+		case opentype.SegmentOpCubeTo:
+			x2, y2 := pt(s.Args[1])
+			x3, y3 := pt(s.Args[2])
+			dc.CubicTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	dc.Fill()
+}
@@ -0,0 +1,132 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/shaping"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestText_Shaped(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"LGTM", false},
+		{"最高です", false},
+		{"שלום", true},
+		{"مرحبا", true},
+		{"नमस्ते", true},
+		{"é", true},
+	}
+	for _, tt := range tests {
+		text := NewMainText(tt.text, TextColorWhite)
+		assert.Equal(t, tt.want, text.shaped(), tt.text)
+		if tt.want {
+			assert.Equal(t, tt.text, text.displayString())
+		} else {
+			assert.Equal(t, text.Text.String(), text.displayString())
+		}
+	}
+}
+
+func TestVisualOrder(t *testing.T) {
+	run := func(offset int, dir di.Direction) shaping.Output {
+		out := shaping.Output{Direction: dir}
+		out.Runes.Offset = offset
+		return out
+	}
+	offsets := func(outputs []shaping.Output) []int {
+		var got []int
+		for _, out := range outputs {
+			got = append(got, out.Runes.Offset)
+		}
+		return got
+	}
+	ltr, rtl := di.DirectionLTR, di.DirectionRTL
+	logical := []shaping.Output{run(0, ltr), run(1, rtl), run(2, rtl), run(3, ltr), run(4, rtl)}
+
+	// 左から右への段落では右から左へ書くランの並びだけを反転する
+	assert.Equal(t, []int{0, 2, 1, 3, 4}, offsets(visualOrder(logical, ltr)))
+	// 右から左への段落では全体を反転し、左から右へ書くランは元の順に戻す
+	assert.Equal(t, []int{4, 3, 2, 1, 0}, offsets(visualOrder(logical, rtl)))
+	assert.Equal(t, []int{3, 1, 2, 0}, offsets(visualOrder([]shaping.Output{run(0, rtl), run(1, ltr), run(2, ltr), run(3, rtl)}, rtl)))
+	// 元のスライスは並べ替えない
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, offsets(logical))
+}
+
+func TestShapedRuns(t *testing.T) {
+	em := 40.0
+	face, err := NotoSansMono.FontFace(em * 72 / fontDPI)
+	require.NoError(t, err)
+	defer face.Close()
+	a, ok := face.GlyphAdvance('a')
+	require.True(t, ok)
+	advance := float64(a) / 64
+
+	// 右から左への段落では、後ろにある左から右への文字列が左端に来る
+	text := NewMainText("של ab", TextColorWhite)
+	runs, width, err := shapedRuns(text, em)
+	require.NoError(t, err)
+	require.Len(t, runs, 5)
+	assert.Zero(t, runs[0].start)
+	assert.InDelta(t, advance, runs[1].start, 0.5)
+	assert.InDelta(t, advance*5, width, 1)
+	assert.NotEmpty(t, runs[0].outline)
+	assert.Empty(t, runs[2].outline, "space")
+	// フォントにないヘブライ文字はggと同じく.notdefのグリフで描く
+	assert.NotEmpty(t, runs[4].outline)
+
+	// 結合文字は前の文字に重ねる
+	text = NewMainText("x\u0301y", TextColorWhite)
+	runs, width, err = shapedRuns(text, em)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.InDelta(t, advance*2, width, 1)
+	assert.Less(t, runs[1].start, advance)
+	assert.Less(t, runs[1].bounds.maxY+runs[1].dy, runs[0].bounds.minY+runs[0].dy+1)
+
+	text.Font = Font("not a font")
+	_, _, err = shapedRuns(text, em)
+	assert.ErrorIs(t, err, ErrFontLoad)
+}
+
+func TestLayout_Shaped(t *testing.T) {
+	canvas := image.Rect(0, 0, 400, 300)
+	main, sub := NewMainText("Café LGTM", TextColorWhite), NewSubText("ạb̈c ש ok", TextColorWhite)
+	main.Rotation = -10
+	d := &TextDrawer{MainText: main, SubText: sub}
+	layout, err := d.layout(context.Background(), canvas)
+	require.NoError(t, err)
+	for _, b := range layout.Boxes() {
+		require.NotNil(t, b.glyphs)
+		assert.True(t, b.Bounds.In(canvas), "%q %v overflows the image", b.Text.Text, b.Bounds)
+	}
+	assert.False(t, layout.Main.Bounds.Overlaps(layout.Sub.Bounds))
+
+	// 輪郭で描いたピクセルもBoundsに収まる
+	render, err := d.renderer(layout)
+	require.NoError(t, err)
+	dc := gg.NewContext(canvas.Dx(), canvas.Dy())
+	dc.SetColor(color.Black)
+	dc.Clear()
+	require.NoError(t, render(dc, 0))
+	img := dc.Image()
+	inside := layout.Main.Bounds.Union(layout.Sub.Bounds)
+	drawn := 0
+	for y := 0; y < canvas.Dy(); y++ {
+		for x := 0; x < canvas.Dx(); x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r > 0 {
+				require.True(t, image.Pt(x, y).In(inside), "pixel (%d, %d) is drawn outside %v", x, y, inside)
+				drawn++
+			}
+		}
+	}
+	assert.Positive(t, drawn)
+}
@@ -0,0 +1,262 @@
+package lgtm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidSpec はスペックの内容に誤りがある場合のエラー
+// 詳細は errors.As で *SpecError として取り出せる
+var ErrInvalidSpec = errors.New("invalid render spec")
+
+// SpecError はスペックのどの項目が誤っているかを表す
+type SpecError struct {
+	Path  string // スペックファイルのパス（ファイルから読み込んでいない場合は空）
+	Field string // 誤りのある項目（"layers[1].color" など）
+	Err   error
+}
+
+func (e *SpecError) Error() string {
+	var b strings.Builder
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field + ": ")
+	}
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SpecError) Is(target error) bool {
+	return target == ErrInvalidSpec
+}
+
+// LayerType はレイヤーの種類
+type LayerType string
+
+const (
+	LayerText               LayerType = "text"                // テキスト
+	LayerSticker            LayerType = "sticker"             // 画像（"gopher"で埋め込みのGopher）
+	LayerConcentrationLines LayerType = "concentration_lines" // 集中線
+	LayerShape              LayerType = "shape"               // 矩形・楕円
+	LayerFilter             LayerType = "filter"              // 画像全体へのフィルタ
+)
+
+// Spec は入力画像に重ねるレイヤーを下から順に並べた描画の設定
+// 位置と大きさはキャンバスの幅・高さに対する比率（0〜1）で指定する
+type Spec struct {
+	Input  string   `json:"input,omitempty" yaml:"input,omitempty"`
+	Output string   `json:"output,omitempty" yaml:"output,omitempty"`
+	Layers []*Layer `json:"layers" yaml:"layers"`
+}
+
+// Layer はスペックの1レイヤー
+// 種類ごとに使う項目だけを指定し、それ以外は省略する
+type Layer struct {
+	Type LayerType `json:"type" yaml:"type"`
+
+	// text, sticker, shape の中心位置、concentration_lines の線が集まる点（省略時は0.5）
+	X *float64 `json:"x,omitempty" yaml:"x,omitempty"`
+	Y *float64 `json:"y,omitempty" yaml:"y,omitempty"`
+
+	// text, shape, concentration_lines の色（"white"、"black"、"#rgb"、"#rrggbb"、"#rrggbbaa"）
+	Color string `json:"color,omitempty" yaml:"color,omitempty"`
+
+	// text
+	Text string  `json:"text,omitempty" yaml:"text,omitempty"`
+	Font string  `json:"font,omitempty" yaml:"font,omitempty"` // フォントファイルのパス（省略時はNotoSansMono）
+	Size float64 `json:"size,omitempty" yaml:"size,omitempty"` // 高さに対する1emの大きさの比率（省略時は幅に収まる大きさ）
+
+	// sticker
+	Image string `json:"image,omitempty" yaml:"image,omitempty"` // 画像のパスまたは"gopher"
+
+	// sticker, shape の大きさ（stickerで省略した場合は元の大きさ、heightは縦横比を保つ）
+	Width  float64 `json:"width,omitempty" yaml:"width,omitempty"`
+	Height float64 `json:"height,omitempty" yaml:"height,omitempty"`
+
+	// shape
+	Shape       string  `json:"shape,omitempty" yaml:"shape,omitempty"`               // "rect" または "ellipse"
+	StrokeWidth float64 `json:"stroke_width,omitempty" yaml:"stroke_width,omitempty"` // 短辺に対する枠線の太さの比率（0より大きければ塗りつぶさず枠線だけ描く）
+
+	// concentration_lines
+	Count int   `json:"count,omitempty" yaml:"count,omitempty"` // 線の本数（省略時は200）
+	Seed  int64 `json:"seed,omitempty" yaml:"seed,omitempty"`   // 線の配置の乱数シード（省略時は描画のたびに変わる）
+
+	// filter
+	Filter string  `json:"filter,omitempty" yaml:"filter,omitempty"` // "grayscale", "invert", "blur", "brightness", "contrast"
+	Amount float64 `json:"amount,omitempty" yaml:"amount,omitempty"` // blurはシグマ、brightness・contrastは-100〜100の割合
+}
+
+// LoadSpec はJSONまたはYAMLのスペックファイルを読み込む
+// 入出力・フォント・ステッカーの相対パスはスペックファイルのディレクトリを基準にする（URLの入力画像は除く）
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(spec)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(spec)
+	default:
+		return nil, &SpecError{Path: path, Err: fmt.Errorf("unsupported extension %q: must be .json, .yaml or .yml", filepath.Ext(path))}
+	}
+	if err != nil {
+		return nil, &SpecError{Path: path, Err: err}
+	}
+
+	dir := filepath.Dir(path)
+	// URLの入力画像はCLIがダウンロードするため、そのまま残す
+	if !IsURL(spec.Input) {
+		spec.Input = resolvePath(dir, spec.Input)
+	}
+	spec.Output = resolvePath(dir, spec.Output)
+	for _, l := range spec.Layers {
+		l.Font = resolvePath(dir, l.Font)
+		if l.Image != "gopher" {
+			l.Image = resolvePath(dir, l.Image)
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		var e *SpecError
+		if errors.As(err, &e) {
+			e.Path = path
+		}
+		return nil, err
+	}
+	return spec, nil
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Validate はレイヤーの種類ごとに必要な項目と値の範囲を検査する
+func (s *Spec) Validate() error {
+	if len(s.Layers) == 0 {
+		return &SpecError{Field: "layers", Err: errors.New("at least one layer is required")}
+	}
+	for i, l := range s.Layers {
+		if l == nil {
+			return &SpecError{Field: fmt.Sprintf("layers[%d]", i), Err: errors.New("empty layer")}
+		}
+		if field, err := l.validate(); err != nil {
+			return &SpecError{Field: fmt.Sprintf("layers[%d]%s", i, field), Err: err}
+		}
+	}
+	return nil
+}
+
+// validate は誤りのある項目名（".color" など）とエラーを返す
+func (l *Layer) validate() (string, error) {
+	if l.Color != "" {
+		if _, err := ParseColor(l.Color); err != nil {
+			return ".color", err
+		}
+	}
+	if l.X != nil && (*l.X < 0 || *l.X > 1) {
+		return ".x", fmt.Errorf("%v is out of range [0, 1]", *l.X)
+	}
+	if l.Y != nil && (*l.Y < 0 || *l.Y > 1) {
+		return ".y", fmt.Errorf("%v is out of range [0, 1]", *l.Y)
+	}
+
+	switch l.Type {
+	case LayerText:
+		if l.Text == "" {
+			return ".text", errors.New("required for text layers")
+		}
+		if l.Size < 0 || l.Size > 1 {
+			return ".size", fmt.Errorf("%v is out of range [0, 1]", l.Size)
+		}
+	case LayerSticker:
+		if l.Image == "" {
+			return ".image", errors.New("required for sticker layers")
+		}
+		if l.Width < 0 || l.Width > 1 {
+			return ".width", fmt.Errorf("%v is out of range [0, 1]", l.Width)
+		}
+	case LayerShape:
+		if l.Shape != "rect" && l.Shape != "ellipse" {
+			return ".shape", fmt.Errorf("invalid shape %q: must be 'rect' or 'ellipse'", l.Shape)
+		}
+		if l.Width <= 0 || l.Width > 1 {
+			return ".width", fmt.Errorf("%v is out of range (0, 1]", l.Width)
+		}
+		if l.Height <= 0 || l.Height > 1 {
+			return ".height", fmt.Errorf("%v is out of range (0, 1]", l.Height)
+		}
+		if l.StrokeWidth < 0 {
+			return ".stroke_width", fmt.Errorf("%v must not be negative", l.StrokeWidth)
+		}
+	case LayerConcentrationLines:
+		if l.Count < 0 {
+			return ".count", fmt.Errorf("%d must not be negative", l.Count)
+		}
+	case LayerFilter:
+		switch l.Filter {
+		case "grayscale", "invert":
+		case "blur":
+			if l.Amount < 0 {
+				return ".amount", fmt.Errorf("%v must not be negative", l.Amount)
+			}
+		case "brightness", "contrast":
+			if l.Amount < -100 || l.Amount > 100 {
+				return ".amount", fmt.Errorf("%v is out of range [-100, 100]", l.Amount)
+			}
+		default:
+			return ".filter", fmt.Errorf("invalid filter %q: must be one of grayscale, invert, blur, brightness, contrast", l.Filter)
+		}
+	default:
+		return ".type", fmt.Errorf("invalid type %q: must be one of text, sticker, concentration_lines, shape, filter", l.Type)
+	}
+	return "", nil
+}
+
+// ParseColor は色の名前（"white"、"black"）または16進数の色（"#rgb"、"#rrggbb"、"#rrggbbaa"）を解釈する
+func ParseColor(s string) (color.Color, error) {
+	switch s {
+	case "white":
+		return color.White, nil
+	case "black":
+		return color.Black, nil
+	}
+
+	hex, ok := strings.CutPrefix(s, "#")
+	if ok && len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if ok && len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 8 || err != nil {
+		return nil, fmt.Errorf("invalid color %q: must be 'white', 'black' or #rgb, #rrggbb, #rrggbbaa", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
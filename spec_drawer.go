@@ -0,0 +1,296 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+
+	"github.com/disintegration/imaging"
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// SpecDrawer は Spec のレイヤーを下から順に入力画像に重ねて描画する
+type SpecDrawer struct {
+	Spec       *Spec
+	InputPath  string
+	OutputPath string
+	Workers    int    // GIFのフレームを並列に描画するゴルーチン数（0以下ならGOMAXPROCS）
+	Limits     Limits // デコード前に検査する入力画像とステッカー画像の上限
+}
+
+func NewSpecDrawer(spec *Spec) Drawer {
+	return &SpecDrawer{
+		Spec:       spec,
+		InputPath:  spec.Input,
+		OutputPath: spec.Output,
+		Limits:     DefaultLimits,
+	}
+}
+
+// RenderSpec はスペックの入力画像にレイヤーを重ねて出力する
+func RenderSpec(ctx context.Context, spec *Spec) error {
+	return DrawContext(ctx, NewSpecDrawer(spec))
+}
+
+func (s *SpecDrawer) Draw() error {
+	return s.DrawContext(context.Background())
+}
+
+func (s *SpecDrawer) DrawContext(ctx context.Context) error {
+	if err := s.Spec.Validate(); err != nil {
+		return err
+	}
+	ext, err := inspect(s.InputPath, s.Limits)
+	if err != nil {
+		return err
+	}
+
+	if ext == "gif" {
+		return s.drawOnGIF(ctx, s.InputPath, s.OutputPath)
+	}
+	return s.drawOnImage(ctx, s.InputPath, s.OutputPath, ext)
+}
+
+func (s *SpecDrawer) newFilename(inputPath, outputPath, ext string) string {
+	if outputPath != "" {
+		return outputPath
+	}
+	return DefaultOutputPath(inputPath, "lgtm", ext)
+}
+
+func (s *SpecDrawer) drawOnGIF(ctx context.Context, inputPath, outputPath string) error {
+	orgGif, err := openGIF(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	layers, err := s.prepare(ctx, gifScreen(orgGif))
+	if err != nil {
+		return newError(StageLayout, inputPath, nil, err)
+	}
+	err = drawFrames(ctx, orgGif, s.Workers, func() (frameRenderer, error) {
+		return s.renderer(layers)
+	})
+	if err != nil {
+		return newError(StageRender, inputPath, nil, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return saveGIF(orgGif, inputPath, s.newFilename(inputPath, outputPath, "gif"))
+}
+
+func (s *SpecDrawer) drawOnImage(ctx context.Context, inputPath, outputPath, ext string) error {
+	img, err := openImage(inputPath)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	layers, err := s.prepare(ctx, img.Bounds())
+	if err != nil {
+		return newError(StageLayout, inputPath, nil, err)
+	}
+	render, err := s.renderer(layers)
+	if err != nil {
+		return newError(StageLayout, inputPath, nil, err)
+	}
+	dc := newCanvas(img)
+	if err := render(dc, 0); err != nil {
+		return newError(StageRender, inputPath, nil, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return saveImage(dc.Image(), inputPath, s.newFilename(inputPath, outputPath, ext))
+}
+
+// specLayer はキャンバスの大きさから計算したレイヤー1つ分の描画内容
+// GIFでは全フレームでこの結果を使い回す
+type specLayer struct {
+	layer   *Layer
+	color   color.Color
+	x, y    float64 // 中心位置（ピクセル）
+	w, h    float64 // shapeの大きさ（ピクセル）
+	text    *TextBox
+	sticker image.Image
+	lines   *ConcentrationLinesDrawer
+}
+
+// prepare はフォントやステッカー画像を読み込み、各レイヤーの位置と大きさを計算する
+func (s *SpecDrawer) prepare(ctx context.Context, canvas image.Rectangle) ([]*specLayer, error) {
+	width, height := float64(canvas.Dx()), float64(canvas.Dy())
+
+	layers := make([]*specLayer, 0, len(s.Spec.Layers))
+	for _, l := range s.Spec.Layers {
+		// テキストのフォントサイズの二分探索は重いため、レイヤーごとにキャンセルを確認する
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		sl := &specLayer{layer: l, x: width * 0.5, y: height * 0.5}
+		if l.X != nil {
+			sl.x = width * *l.X
+		}
+		if l.Y != nil {
+			sl.y = height * *l.Y
+		}
+		sl.color = color.White
+		if l.Type == LayerConcentrationLines {
+			sl.color = color.Black
+		}
+		if l.Color != "" {
+			c, err := ParseColor(l.Color)
+			if err != nil {
+				return nil, err
+			}
+			sl.color = c
+		}
+
+		switch l.Type {
+		case LayerText:
+			f := NotoSansMono
+			if l.Font != "" {
+				data, err := os.ReadFile(l.Font)
+				if err != nil {
+					return nil, &Error{Path: l.Font, Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+				}
+				f = Font(data)
+			}
+			text := &Text{Text: PaddingText(l.Text), Font: f, MessageType: MessageTypeMain}
+			// Sizeは高さに対する1emの比率。フォントサイズはポイントのためピクセルから換算する
+			fontSize := height * l.Size * 72 / fontDPI
+			if l.Size == 0 {
+				fontSize = text.fontSize(canvas)
+			}
+			// グリフの中心を指定した位置に合わせる
+			box, err := newTextBox(text, fontSize, Point{X: sl.x, Y: sl.y}, false)
+			if err != nil {
+				return nil, err
+			}
+			sl.text = box
+
+		case LayerSticker:
+			img, err := s.sticker(l.Image)
+			if err != nil {
+				return nil, err
+			}
+			if l.Width > 0 {
+				img = imaging.Resize(img, max(int(width*l.Width), 1), 0, imaging.Lanczos)
+			}
+			sl.sticker = img
+
+		case LayerShape:
+			sl.w, sl.h = width*l.Width, height*l.Height
+
+		case LayerConcentrationLines:
+			count := l.Count
+			if count == 0 {
+				count = 200
+			}
+			sl.lines = &ConcentrationLinesDrawer{LineCount: count, LineColor: sl.color, Seed: l.Seed, Focus: &Point{X: sl.x, Y: sl.y}}
+		}
+		layers = append(layers, sl)
+	}
+	return layers, nil
+}
+
+// sticker はステッカー画像を読み込む。"gopher"は埋め込みのGopherを使う
+func (s *SpecDrawer) sticker(path string) (image.Image, error) {
+	if path == "gopher" {
+		return GopherPng.Image()
+	}
+	if _, err := inspect(path, s.Limits); err != nil {
+		return nil, err
+	}
+	return openImage(path)
+}
+
+// renderer は計算済みのレイヤーを描画するframeRendererを作成する
+// font.Faceはゴルーチン間で共有できないため、呼び出しごとに生成する
+func (s *SpecDrawer) renderer(layers []*specLayer) (frameRenderer, error) {
+	faces := make([]font.Face, len(layers))
+	for i, sl := range layers {
+		if sl.text == nil {
+			continue
+		}
+		face, err := sl.text.Text.Font.FontFace(sl.text.FontSize)
+		if err != nil {
+			return nil, &Error{Stage: StageLayout, Kind: ErrFontLoad, Err: err}
+		}
+		faces[i] = face
+	}
+
+	return func(dc *gg.Context, index int) error {
+		for i, sl := range layers {
+			l := sl.layer
+			switch l.Type {
+			case LayerText:
+				dc.SetFontFace(faces[i])
+				dc.SetColor(sl.color)
+				sl.text.draw(dc, 0, 0)
+
+			case LayerSticker:
+				dc.DrawImageAnchored(sl.sticker, int(sl.x), int(sl.y), 0.5, 0.5)
+
+			case LayerShape:
+				if l.Shape == "ellipse" {
+					dc.DrawEllipse(sl.x, sl.y, sl.w/2, sl.h/2)
+				} else {
+					dc.DrawRectangle(sl.x-sl.w/2, sl.y-sl.h/2, sl.w, sl.h)
+				}
+				dc.SetColor(sl.color)
+				if l.StrokeWidth > 0 {
+					dc.SetLineWidth(l.StrokeWidth * math.Min(float64(dc.Width()), float64(dc.Height())))
+					dc.Stroke()
+				} else {
+					dc.Fill()
+				}
+
+			case LayerConcentrationLines:
+				sl.lines.drawConcentrationLines(dc, index, *sl.lines.Focus)
+
+			case LayerFilter:
+				applyFilter(dc, l)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// applyFilter はキャンバス全体にフィルタをかけて描画済みの内容を置き換える
+func applyFilter(dc *gg.Context, l *Layer) {
+	canvas := dc.Image().(*image.RGBA)
+
+	var filtered *image.NRGBA
+	switch l.Filter {
+	case "grayscale":
+		filtered = imaging.Grayscale(canvas)
+	case "invert":
+		filtered = imaging.Invert(canvas)
+	case "blur":
+		sigma := l.Amount
+		if sigma == 0 {
+			sigma = 2
+		}
+		filtered = imaging.Blur(canvas, sigma)
+	case "brightness":
+		filtered = imaging.AdjustBrightness(canvas, l.Amount)
+	case "contrast":
+		filtered = imaging.AdjustContrast(canvas, l.Amount)
+	default:
+		return
+	}
+	draw.Draw(canvas, canvas.Bounds(), filtered, image.Point{}, draw.Src)
+}
@@ -0,0 +1,317 @@
+package lgtm
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/font"
+)
+
+func writeTestPNG(t *testing.T, path string, width, height int, c color.Color) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, png.Encode(f, img))
+}
+
+func TestLoadSpec(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "spec.yaml")
+	require.NoError(t, os.WriteFile(yamlPath, []byte(`input: images/cat.png
+layers:
+  - type: text
+    text: SHIP IT
+    font: fonts/custom.otf
+    color: "#fc0"
+    y: 0.8
+  - type: sticker
+    image: gopher
+  - type: sticker
+    image: /abs/sticker.png
+`), 0o644))
+
+	spec, err := LoadSpec(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "images/cat.png"), spec.Input)
+	assert.Empty(t, spec.Output)
+	require.Len(t, spec.Layers, 3)
+	assert.Equal(t, LayerText, spec.Layers[0].Type)
+	assert.Equal(t, filepath.Join(dir, "fonts/custom.otf"), spec.Layers[0].Font)
+	assert.Equal(t, 0.8, *spec.Layers[0].Y)
+	assert.Nil(t, spec.Layers[0].X)
+	assert.Equal(t, "gopher", spec.Layers[1].Image)
+	assert.Equal(t, "/abs/sticker.png", spec.Layers[2].Image)
+
+	jsonPath := filepath.Join(dir, "spec.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"output": "out.png", "layers": [{"type": "filter", "filter": "grayscale"}]}`), 0o644))
+	spec, err = LoadSpec(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "out.png"), spec.Output)
+	assert.Equal(t, "grayscale", spec.Layers[0].Filter)
+
+	// URLの入力画像はスペックファイルのディレクトリと結合しない
+	urlPath := filepath.Join(dir, "url.yaml")
+	require.NoError(t, os.WriteFile(urlPath, []byte("input: https://example.com/cat.png\nlayers:\n  - type: filter\n    filter: invert\n"), 0o644))
+	spec, err = LoadSpec(urlPath)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/cat.png", spec.Input)
+}
+
+func TestLoadSpec_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{
+			name:    "unknown yaml field",
+			file:    "spec.yaml",
+			content: "layers:\n  - type: text\n    colour: black\n",
+			want:    "line 3: field colour not found",
+		},
+		{
+			name:    "unknown json field",
+			file:    "spec.json",
+			content: `{"layers": [{"type": "text", "colour": "black"}]}`,
+			want:    `unknown field "colour"`,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "spec.toml",
+			content: "",
+			want:    `unsupported extension ".toml"`,
+		},
+		{
+			name:    "invalid layer",
+			file:    "spec.yaml",
+			content: "layers:\n  - type: filter\n    filter: grayscale\n  - type: text\n    text: hi\n    color: red\n",
+			want:    "spec.yaml: layers[1].color: invalid color \"red\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			_, err := LoadSpec(path)
+			assert.ErrorIs(t, err, ErrInvalidSpec)
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+
+	_, err := LoadSpec(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSpec_Validate(t *testing.T) {
+	half, outside := 0.5, 1.5
+
+	tests := []struct {
+		name  string
+		layer *Layer
+		field string
+	}{
+		{name: "text", layer: &Layer{Type: LayerText, Text: "LGTM", X: &half, Size: 0.2}},
+		{name: "sticker", layer: &Layer{Type: LayerSticker, Image: "gopher", Width: 0.3}},
+		{name: "shape", layer: &Layer{Type: LayerShape, Shape: "ellipse", Width: 0.5, Height: 0.5, Color: "#00000080"}},
+		{name: "concentration lines", layer: &Layer{Type: LayerConcentrationLines, Count: 50}},
+		{name: "filter", layer: &Layer{Type: LayerFilter, Filter: "brightness", Amount: -30}},
+		{name: "unknown type", layer: &Layer{Type: "sparkles"}, field: "layers[0].type"},
+		{name: "text without text", layer: &Layer{Type: LayerText}, field: "layers[0].text"},
+		{name: "text size out of range", layer: &Layer{Type: LayerText, Text: "a", Size: 2}, field: "layers[0].size"},
+		{name: "position out of range", layer: &Layer{Type: LayerText, Text: "a", Y: &outside}, field: "layers[0].y"},
+		{name: "sticker without image", layer: &Layer{Type: LayerSticker}, field: "layers[0].image"},
+		{name: "unknown shape", layer: &Layer{Type: LayerShape, Shape: "star", Width: 1, Height: 1}, field: "layers[0].shape"},
+		{name: "shape without size", layer: &Layer{Type: LayerShape, Shape: "rect"}, field: "layers[0].width"},
+		{name: "negative line count", layer: &Layer{Type: LayerConcentrationLines, Count: -1}, field: "layers[0].count"},
+		{name: "unknown filter", layer: &Layer{Type: LayerFilter, Filter: "sepia"}, field: "layers[0].filter"},
+		{name: "filter amount out of range", layer: &Layer{Type: LayerFilter, Filter: "contrast", Amount: 200}, field: "layers[0].amount"},
+		{name: "invalid color", layer: &Layer{Type: LayerShape, Shape: "rect", Width: 1, Height: 1, Color: "#12345"}, field: "layers[0].color"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Spec{Layers: []*Layer{tt.layer}}).Validate()
+			if tt.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var specErr *SpecError
+			require.ErrorAs(t, err, &specErr)
+			assert.Equal(t, tt.field, specErr.Field)
+		})
+	}
+
+	assert.ErrorIs(t, (&Spec{}).Validate(), ErrInvalidSpec)
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.Color
+	}{
+		{in: "white", want: color.White},
+		{in: "black", want: color.Black},
+		{in: "#fc0", want: color.NRGBA{0xff, 0xcc, 0x00, 0xff}},
+		{in: "#12ab34", want: color.NRGBA{0x12, 0xab, 0x34, 0xff}},
+		{in: "#12ab3480", want: color.NRGBA{0x12, 0xab, 0x34, 0x80}},
+	}
+	for _, tt := range tests {
+		got, err := ParseColor(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, in := range []string{"", "red", "fc0", "#ggg", "#1234"} {
+		_, err := ParseColor(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestRenderSpec(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.png")
+	writeTestPNG(t, input, 200, 100, color.RGBA{0xff, 0, 0, 0xff})
+	sticker := filepath.Join(dir, "sticker.png")
+	writeTestPNG(t, sticker, 10, 10, color.RGBA{0, 0xff, 0, 0xff})
+
+	x, y := 0.1, 0.1
+	output := filepath.Join(dir, "output.png")
+	spec := &Spec{
+		Input:  input,
+		Output: output,
+		Layers: []*Layer{
+			{Type: LayerFilter, Filter: "grayscale"},
+			{Type: LayerShape, Shape: "rect", Width: 0.2, Height: 0.2, Color: "#0000ff"},
+			{Type: LayerSticker, Image: sticker, X: &x, Y: &y, Width: 0.1},
+			{Type: LayerText, Text: "OK", Size: 0.1, Y: &y, Color: "black"},
+		},
+	}
+	require.NoError(t, RenderSpec(context.Background(), spec))
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err)
+
+	assert.Equal(t, image.Rect(0, 0, 200, 100), img.Bounds())
+	// 赤い背景はグレースケールになり、中央に青い矩形、左上に緑のステッカーが重なる
+	r, g, b, _ := img.At(190, 90).RGBA()
+	assert.True(t, r == g && g == b, "background should be gray: %d %d %d", r, g, b)
+	assert.Equal(t, color.RGBA{0, 0, 0xff, 0xff}, color.RGBAModel.Convert(img.At(100, 50)))
+	assert.Equal(t, color.RGBA{0, 0xff, 0, 0xff}, color.RGBAModel.Convert(img.At(20, 10)))
+}
+
+func TestRenderSpec_TextSize(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.png")
+	writeTestPNG(t, input, 400, 300, color.RGBA{0, 0, 0, 0xff})
+	output := filepath.Join(dir, "output.png")
+	spec := &Spec{
+		Input:  input,
+		Output: output,
+		Layers: []*Layer{{Type: LayerText, Text: "H", Size: 0.2, Color: "white"}},
+	}
+	require.NoError(t, RenderSpec(context.Background(), spec))
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	require.NoError(t, err)
+
+	// 描いた"H"の高さは、高さの0.2倍の1emに対する大文字の高さになる
+	top, bottom := -1, -1
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r > 0x8000 {
+				if top < 0 {
+					top = y
+				}
+				bottom = y
+				break
+			}
+		}
+	}
+	require.GreaterOrEqual(t, top, 0)
+
+	em := 0.2 * 300
+	face, err := NotoSansMono.FontFace(em * 72 / fontDPI)
+	require.NoError(t, err)
+	bounds, _ := font.BoundString(face, "H")
+	capHeight := float64(bounds.Max.Y-bounds.Min.Y) / 64
+	assert.InDelta(t, capHeight, float64(bottom-top+1), 2)
+	assert.InDelta(t, 0.71*em, capHeight, 3)
+}
+
+func TestRenderSpec_GIF(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.gif")
+	output := filepath.Join(dir, "output.gif")
+	writeTestGIF(t, input, 4, 120, 80)
+
+	spec := &Spec{
+		Input:  input,
+		Output: output,
+		Layers: []*Layer{
+			{Type: LayerConcentrationLines, Count: 20},
+			{Type: LayerText, Text: "LGTM"},
+			{Type: LayerSticker, Image: "gopher", Width: 0.2},
+		},
+	}
+	require.NoError(t, NewSpecDrawer(spec).Draw())
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	require.NoError(t, err)
+	assert.Len(t, g.Image, 4)
+	assert.Equal(t, []int{10, 11, 12, 13}, g.Delay)
+}
+
+func TestRenderSpec_Errors(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.png")
+	writeTestPNG(t, input, 50, 50, color.White)
+
+	err := RenderSpec(context.Background(), &Spec{Input: input, Layers: []*Layer{{Type: "unknown"}}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+
+	err = RenderSpec(context.Background(), &Spec{
+		Input:  input,
+		Output: filepath.Join(dir, "out.png"),
+		Layers: []*Layer{{Type: LayerText, Text: "a", Font: filepath.Join(dir, "missing.otf")}},
+	})
+	assert.ErrorIs(t, err, ErrFontLoad)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = RenderSpec(context.Background(), &Spec{
+		Input:  input,
+		Output: filepath.Join(dir, "out.png"),
+		Layers: []*Layer{{Type: LayerSticker, Image: filepath.Join(dir, "missing.png")}},
+	})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,82 @@
+package lgtm
+
+import (
+	"context"
+	"image/color"
+	"math"
+
+	"github.com/fogleman/gg"
+)
+
+// SpeedLinesDrawer は画像全体に平行な流線を描く
+type SpeedLinesDrawer struct {
+	InputPath  string
+	OutputPath string
+	LineCount  int         // 流線の本数
+	LineColor  color.Color // 線の色
+	Angle      float64     // 線の向き（水平から時計回りの角度。0なら水平、90なら垂直）
+	Seed       int64       // 線の配置の乱数シード（0なら描画のたびに変わる）
+	Workers    int         // ConcentrationLinesDrawer.Workersと同じ
+	Limits     Limits      // ConcentrationLinesDrawer.Limitsと同じ
+}
+
+func NewSpeedLinesDrawer(inputPath, outputPath string) Drawer {
+	return &SpeedLinesDrawer{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		LineCount:  120,
+		LineColor:  color.Black,
+		Limits:     DefaultLimits,
+	}
+}
+
+func (s *SpeedLinesDrawer) Draw() error {
+	return s.DrawContext(context.Background())
+}
+
+func (s *SpeedLinesDrawer) DrawContext(ctx context.Context) error {
+	// 流線は中心を持たない
+	return drawEffect(ctx, s.InputPath, s.OutputPath, "speed", s.Workers, s.Limits, nil, s.drawSpeedLines)
+}
+
+// drawSpeedLines は両端が細い紡錘形の線を、Angleの向きにランダムな位置と長さで描く
+func (s *SpeedLinesDrawer) drawSpeedLines(dc *gg.Context, index int, _ Point) {
+	width, height := float64(dc.Width()), float64(dc.Height())
+	short := math.Min(width, height)
+
+	// 線の向きuと、それに垂直な向きn
+	angle := s.Angle * math.Pi / 180
+	ux, uy := math.Cos(angle), math.Sin(angle)
+	nx, ny := -uy, ux
+	// 画像の四隅をu・nに射影した範囲に線を並べる
+	uMin, uMax, nMin, nMax := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, c := range []Point{{0, 0}, {width, 0}, {0, height}, {width, height}} {
+		u, n := c.X*ux+c.Y*uy, c.X*nx+c.Y*ny
+		uMin, uMax = math.Min(uMin, u), math.Max(uMax, u)
+		nMin, nMax = math.Min(nMin, n), math.Max(nMax, n)
+	}
+	extent := uMax - uMin
+
+	rng := frameRand(s.Seed, index)
+
+	dc.SetColor(s.LineColor)
+	for i := 0; i < s.LineCount; i++ {
+		n := nMin + rng.Float64()*(nMax-nMin)
+		length := extent * (0.3 + rng.Float64()*0.5)
+		start := uMin - length*0.2 + rng.Float64()*(extent-length*0.6)
+		thickness := short * (0.002 + rng.Float64()*0.006)
+
+		// u・nの座標を画像の座標に戻す
+		pt := func(u, n float64) (float64, float64) {
+			return u*ux + n*nx, u*uy + n*ny
+		}
+		mid := start + length/2
+		dc.NewSubPath()
+		dc.MoveTo(pt(start, n))
+		dc.LineTo(pt(mid, n+thickness))
+		dc.LineTo(pt(start+length, n))
+		dc.LineTo(pt(mid, n-thickness))
+		dc.ClosePath()
+		dc.Fill()
+	}
+}
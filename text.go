@@ -66,6 +66,12 @@ type Text struct {
 	Font        Font
 	MessageType MessageType
 	TextColor   TextColor
+	Background  *Background // テキストの後ろに描く背景（nilなら描かない）
+	Fill        *Fill       // グラデーションや模様の塗り（nilならTextColorで塗る）
+	Rotation    float64     // Pointを中心とした時計回りの回転角（度）
+	Arc         float64     // 文字列を沿わせる円弧の中心角（度）。正なら上に凸、負なら下に凸、360で円になる
+	WritingMode WritingMode // 書字方向（メインテキストの指定をサブテキストにも使う）
+	Emoji       EmojiSource // 絵文字の画像（nilなら絵文字もフォントで描く）
 }
 
 func NewMainText(text string, textColor TextColor) *Text {
@@ -87,8 +93,13 @@ func NewSubText(text string, textColor TextColor) *Text {
 }
 
 func (t *Text) FontSize(img image.Image) float64 {
-	imageWidth := img.Bounds().Dx()
-	imageHeight := img.Bounds().Dy()
+	return t.fontSize(img.Bounds())
+}
+
+// fontSize はキャンバスの大きさだけを元にフォントサイズを計算する
+func (t *Text) fontSize(bounds image.Rectangle) float64 {
+	imageWidth := bounds.Dx()
+	imageHeight := bounds.Dy()
 	aspectRatio := float64(imageWidth) / float64(imageHeight)
 
 	// セーフエリアを考慮した利用可能エリア（より保守的に設定）
@@ -120,7 +131,7 @@ func (t *Text) FontSize(img image.Image) float64 {
 		// 最小フォントサイズでも収まらない場合は、幅だけを考慮した最小フォントサイズを計算
 		face, err := t.Font.FontFace(minFontSize)
 		if err == nil {
-			textWidth := t.measureTextWidth(face)
+			textWidth := t.measureTextWidth(face, minFontSize)
 			if textWidth > safeAreaWidth {
 				// 幅に合わせてフォントサイズを計算
 				scaleFactor := safeAreaWidth / textWidth
@@ -135,27 +146,24 @@ func (t *Text) FontSize(img image.Image) float64 {
 	return bestFontSize
 }
 
-// measureTextWidth はテキストの実際の幅を測定する
-func (t *Text) measureTextWidth(face font.Face) float64 {
-	textWidth := 0.0
-	// 平均的な文字幅として'M'の幅を取得
-	mAdvance, hasMAdvance := face.GlyphAdvance('M')
-	
-	for _, r := range t.Text.String() {
-		advance, ok := face.GlyphAdvance(r)
-		if !ok {
-			// グリフが見つからない場合は'M'の幅を使用、それも無い場合は固定値
-			if hasMAdvance {
-				advance = mAdvance
-			} else {
-				// 固定のfallback値（フォントサイズに比例した値）
-				metrics := face.Metrics()
-				advance = metrics.Height / 2 // 高さの半分を幅として使用
+// measureTextWidth はテキストを描画したときにグリフが占める幅を測定する
+// カーニングを含み、フォントにないグリフはggの描画と同じく飛ばす
+// 絵文字の画像はフォントにないため、画像とグリフを並べた幅で測る
+func (t *Text) measureTextWidth(face font.Face, fontSize float64) float64 {
+	if t.hasEmoji() {
+		if runs, width, err := emojiRuns(face, t, fontSize*fontDPI/72); err == nil {
+			if w := inkWidth(runs); w > 0 {
+				return w
 			}
+			return width
 		}
-		textWidth += float64(advance) / 64.0
 	}
-	return textWidth
+	bounds, advance := font.BoundString(face, t.displayString())
+	if bounds.Empty() {
+		// 空白だけのテキストは送り幅で測る
+		return float64(advance) / 64.0
+	}
+	return float64(bounds.Max.X-bounds.Min.X) / 64.0
 }
 
 // textFitsWithFontSize は指定したフォントサイズでテキストが収まるかどうかを判定
@@ -167,7 +175,7 @@ func (t *Text) textFitsWithFontSize(fontSize, safeAreaWidth, safeAreaHeight, asp
 	}
 
 	// テキストの実際の幅を計算
-	textWidth := t.measureTextWidth(face)
+	textWidth := t.measureTextWidth(face, fontSize)
 	
 	// 幅の制約チェック（少し余裕を持たせる）
 	if textWidth > safeAreaWidth * 0.98 {
@@ -215,8 +223,13 @@ func (t *Text) textFitsWithFontSize(fontSize, safeAreaWidth, safeAreaHeight, asp
 }
 
 func (t *Text) Point(img image.Image) *Point {
-	imgWidth := img.Bounds().Dx()
-	imgHeight := img.Bounds().Dy()
+	return t.point(img.Bounds(), t.fontSize(img.Bounds()))
+}
+
+// point は計算済みのフォントサイズを使ってキャンバス上の描画位置を計算する
+func (t *Text) point(bounds image.Rectangle, fontSize float64) *Point {
+	imgWidth := bounds.Dx()
+	imgHeight := bounds.Dy()
 	aspectRatio := float64(imgWidth) / float64(imgHeight)
 
 	// アスペクト比に応じて縦方向のマージンを調整
@@ -238,12 +251,11 @@ func (t *Text) Point(img image.Image) *Point {
 	// X座標は常に中央
 	x := float64(imgWidth) / 2
 
-	// フォントサイズとテキスト高さを取得
-	fontSize := t.FontSize(img)
+	// テキスト高さを取得
 	face, err := t.Font.FontFace(fontSize)
 	if err != nil {
 		// フォント作成エラーの場合は従来のロジックを使用
-		return t.fallbackPoint(img, marginY, safeHeight, x, aspectRatio)
+		return t.fallbackPoint(marginY, safeHeight, x, aspectRatio)
 	}
 
 	metrics := face.Metrics()
@@ -275,12 +287,12 @@ func (t *Text) Point(img image.Image) *Point {
 			MessageType: MessageTypeMain,
 			TextColor:   t.TextColor,
 		}
-		mainFontSize := mainText.FontSize(img)
+		mainFontSize := mainText.fontSize(bounds)
 		mainFace, mainErr := t.Font.FontFace(mainFontSize)
 		
 		if mainErr != nil {
 			// メインテキスト情報取得失敗時は従来ロジック
-			return t.fallbackPoint(img, marginY, safeHeight, x, aspectRatio)
+			return t.fallbackPoint(marginY, safeHeight, x, aspectRatio)
 		}
 		
 		mainMetrics := mainFace.Metrics()
@@ -324,7 +336,7 @@ func (t *Text) Point(img image.Image) *Point {
 }
 
 // fallbackPoint は従来のロジックを使用したポイント計算
-func (t *Text) fallbackPoint(img image.Image, marginY, safeHeight, x, aspectRatio float64) *Point {
+func (t *Text) fallbackPoint(marginY, safeHeight, x, aspectRatio float64) *Point {
 	switch t.MessageType {
 	case MessageTypeMain:
 		var yRatio float64
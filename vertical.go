@@ -0,0 +1,127 @@
+package lgtm
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+)
+
+// WritingMode はテキストの書字方向
+type WritingMode string
+
+const (
+	WritingHorizontal WritingMode = ""         // 横書き
+	WritingVertical   WritingMode = "vertical" // 縦書き（上から下へ文字を積み、メインテキストの左にサブテキストを置く）
+	WritingAuto       WritingMode = "auto"     // 日本語を含むテキストを縦長の画像に描く場合だけ縦書き
+)
+
+const (
+	// verticalRotatedRunes は縦書きで時計回りに90度回転して描く長音記号・ダッシュ・括弧など
+	verticalRotatedRunes = "ー－—―‐-~～〜…‥「」『』（）()［］[]｛｝{}【】〈〉《》〔〕＝=→←"
+	// verticalPunctuationRunes は縦書きで字面の右上に寄せる句読点
+	verticalPunctuationRunes = "、。，．,."
+	// verticalSmallKanaRunes は縦書きでわずかに右上に寄せる小書きの仮名
+	verticalSmallKanaRunes = "ぁぃぅぇぉっゃゅょゎゕゖァィゥェォッャュョヮヵヶ"
+)
+
+// validateWritingMode は書字方向を検査する
+func (t *Text) validateWritingMode() error {
+	switch t.WritingMode {
+	case WritingHorizontal, WritingVertical, WritingAuto:
+		return nil
+	}
+	return fmt.Errorf("invalid writing mode %q: must be 'vertical' or 'auto'", t.WritingMode)
+}
+
+// vertical はキャンバスに縦書きで描くかどうかを返す
+func (t *Text) vertical(canvas image.Rectangle) bool {
+	switch t.WritingMode {
+	case WritingVertical:
+		return true
+	case WritingAuto:
+		return t.Text.HasJP() && canvas.Dy() > canvas.Dx()
+	}
+	return false
+}
+
+// verticalFontSize は縦書きの1列が画像の高さに収まるフォントサイズを計算する
+// 縦長の画像で最も大きく描けるよう、列の長さは高さの80%まで、列の幅は画像の幅の30%までにする
+func (t *Text) verticalFontSize(canvas image.Rectangle) float64 {
+	n := max(len(emojiClusters(t)), 1)
+	heightRatio, widthRatio := 0.8, 0.3
+	if t.MessageType == MessageTypeSub {
+		heightRatio, widthRatio = 0.7, 0.2
+	}
+	em := math.Min(float64(canvas.Dy())*heightRatio/float64(n), float64(canvas.Dx())*widthRatio)
+	return math.Max(em*72/fontDPI, 6)
+}
+
+// verticalPoints は縦書きのメインテキストとサブテキストの列の中心を返す
+// 縦書きは右から左へ読むため、メインテキストを中央より右に、サブテキストをその左に置く
+func verticalPoints(canvas image.Rectangle, mainSize, subSize float64, hasSub bool) (Point, Point) {
+	width, height := float64(canvas.Dx()), float64(canvas.Dy())
+	if !hasSub {
+		return Point{X: width / 2, Y: height / 2}, Point{}
+	}
+	mainEm, subEm := mainSize*fontDPI/72, subSize*fontDPI/72
+	// 2列と間隔を合わせた幅を画像の中央に置く
+	gap := mainEm * 0.4
+	total := mainEm + gap + subEm
+	right := (width + total) / 2
+	main := Point{X: right - mainEm/2, Y: height / 2}
+	sub := Point{X: right - mainEm - gap - subEm/2, Y: height / 2}
+	return main, sub
+}
+
+// stackGlyphs は文字を上から下へ1文字ずつ積み、各文字とドットからのグリフの範囲を返す
+// 文字は幅emの列の中央に揃え、長音記号や括弧は回転し、句読点と小書きの仮名は右上に寄せる
+// PaddingTextの文字間の空白は入れず、絵文字は画像を升目に収める
+func stackGlyphs(face font.Face, t *Text, em float64) ([]placedGlyph, []rect) {
+	var glyphs []placedGlyph
+	var bounds []rect
+	top := 0.0
+	for _, c := range emojiClusters(t) {
+		if c.emoji {
+			if img, ok := t.Emoji.Emoji(c.text); ok && img.Bounds().Dy() > 0 {
+				w := em * float64(img.Bounds().Dx()) / float64(img.Bounds().Dy())
+				glyphs = append(glyphs, placedGlyph{image: img, scale: em / float64(img.Bounds().Dy()), x: -w / 2, y: top + em*emojiAscent})
+				bounds = append(bounds, rect{minX: 0, minY: -em * emojiAscent, maxX: w, maxY: em * (1 - emojiAscent)})
+				top += em
+				continue
+			}
+		}
+		// 画像がない絵文字は先頭の文字だけをフォントで描く
+		r, _ := utf8.DecodeRuneInString(c.text)
+		b, a, ok := face.GlyphBounds(r)
+		if !ok {
+			continue
+		}
+		advance := float64(a) / 64
+		// 字面の中心（em四方の升目の中心）
+		cx, cy := 0.0, top+em/2
+		// ベースラインは升目の下端からディセント分だけ上にある
+		baseline := top + em*0.88
+		x, y, angle := cx-advance/2, baseline, 0.0
+
+		switch {
+		case strings.ContainsRune(verticalRotatedRunes, r):
+			// 升目の中心を軸に時計回りに90度回転する
+			// 横書きのグリフは送り幅の中央・ベースラインよりem*0.38上を中心とみなす
+			gx, gy := rotate(-advance/2, em*0.38, math.Pi/2)
+			x, y, angle = cx+gx, cy+gy, math.Pi/2
+		case strings.ContainsRune(verticalPunctuationRunes, r):
+			x, y = x+em*0.6, y-em*0.6
+		case strings.ContainsRune(verticalSmallKanaRunes, r):
+			x, y = x+em*0.1, y-em*0.1
+		}
+
+		glyphs = append(glyphs, placedGlyph{r: r, x: x, y: y, angle: angle})
+		bounds = append(bounds, fixedRect(b))
+		top += em
+	}
+	return glyphs, bounds
+}
@@ -0,0 +1,77 @@
+package lgtm
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStackGlyphs(t *testing.T) {
+	face, err := NotoSansMono.FontFace(40)
+	require.NoError(t, err)
+	defer face.Close()
+	em := 40.0 * fontDPI / 72
+
+	text := NewMainText("L(.T", TextColorWhite)
+	glyphs, bounds := stackGlyphs(face, text, em)
+	require.Len(t, glyphs, 4)
+	require.Len(t, bounds, 4)
+
+	// 1文字ずつemの間隔で上から下へ積む
+	assert.InDelta(t, em*3, glyphs[3].y-glyphs[0].y, 1e-9)
+	assert.InDelta(t, glyphs[0].x, glyphs[3].x, 1e-9)
+	// 括弧は時計回りに90度回転する
+	assert.InDelta(t, math.Pi/2, glyphs[1].angle, 1e-9)
+	assert.Zero(t, glyphs[0].angle)
+	// 句読点は升目の右上に寄せる
+	assert.Greater(t, glyphs[2].x, glyphs[0].x)
+	assert.Less(t, glyphs[2].y, glyphs[0].y+em*2)
+}
+
+func TestText_Vertical(t *testing.T) {
+	portrait, landscape := image.Rect(0, 0, 300, 600), image.Rect(0, 0, 600, 300)
+	tests := []struct {
+		text   string
+		mode   WritingMode
+		canvas image.Rectangle
+		want   bool
+	}{
+		{"LGTM", WritingHorizontal, portrait, false},
+		{"LGTM", WritingVertical, landscape, true},
+		{"LGTM", WritingAuto, portrait, false},
+		{"よき", WritingAuto, portrait, true},
+		{"よき", WritingAuto, landscape, false},
+	}
+	for _, tt := range tests {
+		text := NewMainText(tt.text, TextColorWhite)
+		text.WritingMode = tt.mode
+		assert.Equal(t, tt.want, text.vertical(tt.canvas), "%+v", tt)
+	}
+
+	text := NewMainText("LGTM", TextColorWhite)
+	text.WritingMode = "diagonal"
+	assert.Error(t, text.validateWritingMode())
+}
+
+func TestLayout_Vertical(t *testing.T) {
+	for _, canvas := range []image.Rectangle{image.Rect(0, 0, 300, 600), image.Rect(0, 0, 600, 300), image.Rect(0, 0, 100, 800)} {
+		t.Run(fmt.Sprintf("%dx%d", canvas.Dx(), canvas.Dy()), func(t *testing.T) {
+			main, sub := NewMainText(DefaultMainText, TextColorWhite), NewSubText(DefaultSubText, TextColorWhite)
+			main.WritingMode = WritingVertical
+			r, err := Layout(canvas, main, sub, LayoutOptions{})
+			require.NoError(t, err)
+
+			// 縦長の列がキャンバスに収まり、サブテキストはメインテキストの左に重ならずに並ぶ
+			for _, b := range r.Boxes() {
+				assert.True(t, b.Bounds.In(canvas), "%v not in %v", b.Bounds, canvas)
+				assert.Greater(t, b.Bounds.Dy(), b.Bounds.Dx())
+			}
+			assert.False(t, r.Main.Bounds.Overlaps(r.Sub.Bounds))
+			assert.LessOrEqual(t, r.Sub.Bounds.Max.X, r.Main.Bounds.Min.X)
+		})
+	}
+}